@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"net"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -38,13 +39,15 @@ func main() {
 		"release": utils.BuildRelease,
 	}).Printf("starting")
 
-	startDugtrio(config)
+	beaconProxy := startDugtrio(config)
 
 	utils.WaitForCtrlC()
 	logrus.Println("exiting...")
+
+	beaconProxy.Shutdown()
 }
 
-func startDugtrio(config *types.Config) {
+func startDugtrio(config *types.Config) *proxy.BeaconProxy {
 	// init pool
 	beaconPool, err := pool.NewBeaconPool(config.Pool)
 	if err != nil {
@@ -88,6 +91,20 @@ func startDugtrio(config *types.Config) {
 	router.PathPrefix("/prysm/").Handler(beaconProxy.NewClientSpecificProxy(pool.PrysmClient))
 	router.PathPrefix("/teku/").Handler(beaconProxy.NewClientSpecificProxy(pool.TekuClient))
 
+	// merged event stream across all endpoints
+	if config.Proxy.MergedEvents {
+		router.Path("/dugtrio/events").Handler(beaconProxy)
+	}
+
+	// usage accounting api
+	if config.Proxy.Usage != nil && config.Proxy.Usage.Enabled {
+		router.HandleFunc("/dugtrio/usage", beaconProxy.ServeUsageHTTP).Methods("GET")
+		router.HandleFunc("/dugtrio/usage.csv", beaconProxy.ServeUsageCSVHTTP).Methods("GET")
+	}
+
+	// ban list management api
+	router.HandleFunc("/dugtrio/bans", beaconProxy.ServeBansHTTP).Methods("GET", "POST", "DELETE")
+
 	// healthcheck endpoint
 	router.HandleFunc("/healthcheck", beaconProxy.ServeHealthCheckHTTP).Methods("GET")
 
@@ -107,16 +124,21 @@ func startDugtrio(config *types.Config) {
 		router.HandleFunc("/", frontendHandler.Index).Methods("GET")
 		router.HandleFunc("/health", frontendHandler.Health).Methods("GET")
 		router.HandleFunc("/sessions", frontendHandler.Sessions).Methods("GET")
+		router.HandleFunc("/consistency", frontendHandler.Consistency).Methods("GET")
+		router.HandleFunc("/usage", frontendHandler.Usage).Methods("GET")
+		router.HandleFunc("/bans", frontendHandler.Bans).Methods("GET")
 		router.PathPrefix("/").Handler(frontendBaseHandler)
 	}
 
 	// start http server
 	startHTTPServer(config.Server, router)
+
+	return beaconProxy
 }
 
 func startHTTPServer(config *types.ServerConfig, router *mux.Router) {
 	n := negroni.New()
-	n.Use(negroni.NewRecovery())
+	n.Use(negroni.HandlerFunc(utils.HandleHTTPPanic))
 	n.UseHandler(router)
 
 	if config.Host == "" {
@@ -135,10 +157,41 @@ func startHTTPServer(config *types.ServerConfig, router *mux.Router) {
 		Handler:      n,
 	}
 
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error listening on http address")
+	}
+
+	if config.ProxyProtocol {
+		listener, err = utils.NewProxyProtocolListener(listener, utils.SplitConfigList(config.ProxyProtocolSources, config.ProxyProtocolSourcesStr))
+		if err != nil {
+			logrus.WithError(err).Fatal("Error initializing proxy protocol listener")
+		}
+	}
+
+	if config.TLS != nil && config.TLS.CertFile != "" {
+		tlsLoader, err := utils.NewTLSConfigLoader(config.TLS)
+		if err != nil {
+			logrus.WithError(err).Fatal("Error loading tls config")
+		}
+
+		srv.TLSConfig = tlsLoader.GetServerConfig()
+
+		logrus.Printf("https server listening on %v", srv.Addr)
+
+		go func() {
+			if err := srv.ServeTLS(listener, "", ""); err != nil {
+				logrus.WithError(err).Fatal("Error serving frontend")
+			}
+		}()
+
+		return
+	}
+
 	logrus.Printf("http server listening on %v", srv.Addr)
 
 	go func() {
-		if err := srv.ListenAndServe(); err != nil {
+		if err := srv.Serve(listener); err != nil {
 			logrus.WithError(err).Fatal("Error serving frontend")
 		}
 	}()
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ethpandaops/dugtrio/frontend"
+)
+
+type BansPage struct {
+	AutoBan bool             `json:"auto_ban"`
+	Bans    []*BansPageEntry `json:"bans"`
+}
+
+type BansPageEntry struct {
+	IP        string `json:"ip"`
+	Reason    string `json:"reason"`
+	Comment   string `json:"comment"`
+	Created   string `json:"created"`
+	Expires   string `json:"expires"`
+	Permanent bool   `json:"permanent"`
+
+	ExpiresTime time.Time `json:"-"`
+}
+
+// Bans will return the "bans" page using a go template
+func (fh *FrontendHandler) Bans(w http.ResponseWriter, r *http.Request) {
+	templateFiles := frontend.LayoutTemplateFiles
+	templateFiles = append(templateFiles, "bans/bans.html")
+	pageTemplate := frontend.GetTemplate(templateFiles...)
+	data := frontend.InitPageData(w, r, "bans", "/bans", "Bans", templateFiles)
+
+	var pageError error
+
+	data.Data, pageError = fh.getBansPageData()
+	if pageError != nil {
+		frontend.HandlePageError(w, r, pageError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+
+	if frontend.HandleTemplateError(w, r, "bans.go", "Bans", "", pageTemplate.ExecuteTemplate(w, "layout", data)) != nil {
+		return // an error has occurred and was processed
+	}
+}
+
+func (fh *FrontendHandler) getBansPageData() (*BansPage, error) {
+	pageData := &BansPage{
+		AutoBan: fh.proxy.IsAutoBanEnabled(),
+		Bans:    []*BansPageEntry{},
+	}
+
+	for _, ban := range fh.proxy.GetBans() {
+		entry := &BansPageEntry{
+			IP:        ban.IP,
+			Reason:    ban.Reason,
+			Comment:   ban.Comment,
+			Created:   ban.Created.Format("2006-01-02 15:04:05"),
+			Permanent: ban.Expires.IsZero(),
+		}
+
+		if !entry.Permanent {
+			entry.Expires = ban.Expires.Format("2006-01-02 15:04:05")
+			entry.ExpiresTime = ban.Expires
+		}
+
+		pageData.Bans = append(pageData.Bans, entry)
+	}
+
+	return pageData, nil
+}
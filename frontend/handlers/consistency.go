@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/ethpandaops/dugtrio/frontend"
+)
+
+type ConsistencyPage struct {
+	Enabled     bool                         `json:"enabled"`
+	Stats       []*ConsistencyPageStats      `json:"stats"`
+	Divergences []*ConsistencyPageDivergence `json:"divergences"`
+}
+
+type ConsistencyPageStats struct {
+	Primary     string `json:"primary"`
+	Shadow      string `json:"shadow"`
+	Path        string `json:"path"`
+	Checks      uint64 `json:"checks"`
+	Divergences uint64 `json:"divergences"`
+	Errors      uint64 `json:"errors"`
+	LastCheck   string `json:"last_check"`
+}
+
+type ConsistencyPageDivergence struct {
+	Index         int    `json:"index"`
+	Time          string `json:"time"`
+	Method        string `json:"method"`
+	URL           string `json:"url"`
+	Primary       string `json:"primary"`
+	Shadow        string `json:"shadow"`
+	PrimaryStatus int    `json:"primary_status"`
+	ShadowStatus  int    `json:"shadow_status"`
+	PrimaryBody   string `json:"primary_body"`
+	ShadowBody    string `json:"shadow_body"`
+	Difference    string `json:"difference"`
+}
+
+// Consistency will return the "consistency" page using a go template
+func (fh *FrontendHandler) Consistency(w http.ResponseWriter, r *http.Request) {
+	templateFiles := frontend.LayoutTemplateFiles
+	templateFiles = append(templateFiles, "consistency/consistency.html")
+	pageTemplate := frontend.GetTemplate(templateFiles...)
+	data := frontend.InitPageData(w, r, "consistency", "/consistency", "Consistency", templateFiles)
+
+	var pageError error
+
+	data.Data, pageError = fh.getConsistencyPageData()
+	if pageError != nil {
+		frontend.HandlePageError(w, r, pageError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+
+	if frontend.HandleTemplateError(w, r, "consistency.go", "Consistency", "", pageTemplate.ExecuteTemplate(w, "layout", data)) != nil {
+		return // an error has occurred and was processed
+	}
+}
+
+func (fh *FrontendHandler) getConsistencyPageData() (*ConsistencyPage, error) {
+	pageData := &ConsistencyPage{
+		Stats:       []*ConsistencyPageStats{},
+		Divergences: []*ConsistencyPageDivergence{},
+	}
+
+	checker := fh.proxy.GetShadowChecker()
+	if checker == nil {
+		return pageData, nil
+	}
+
+	pageData.Enabled = true
+
+	for _, stats := range checker.GetStats() {
+		pageData.Stats = append(pageData.Stats, &ConsistencyPageStats{
+			Primary:     stats.Primary,
+			Shadow:      stats.Shadow,
+			Path:        stats.Path,
+			Checks:      stats.Checks,
+			Divergences: stats.Divergences,
+			Errors:      stats.Errors,
+			LastCheck:   stats.LastCheck.Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	for index, divergence := range checker.GetDivergences() {
+		pageData.Divergences = append(pageData.Divergences, &ConsistencyPageDivergence{
+			Index:         index + 1,
+			Time:          divergence.Time.Format("2006-01-02 15:04:05"),
+			Method:        divergence.Method,
+			URL:           divergence.URL,
+			Primary:       divergence.Primary,
+			Shadow:        divergence.Shadow,
+			PrimaryStatus: divergence.PrimaryStatus,
+			ShadowStatus:  divergence.ShadowStatus,
+			PrimaryBody:   string(divergence.PrimaryBody),
+			ShadowBody:    string(divergence.ShadowBody),
+			Difference:    divergence.Difference,
+		})
+	}
+
+	return pageData, nil
+}
@@ -32,6 +32,7 @@ type HealthPageClient struct {
 	LastRefresh       time.Time `json:"refresh"`
 	LastError         string    `json:"error"`
 	IsReady           bool      `json:"ready"`
+	IsMirror          bool      `json:"mirror"`
 	CustodyGroupCount int       `json:"custody_group_count"`
 }
 
@@ -158,6 +159,7 @@ func (fh *FrontendHandler) getHealthPageClientData(client *pool.Client) *HealthP
 		HeadRoot:          headRoot[:],
 		LastRefresh:       client.GetLastEventTime(),
 		IsReady:           fh.pool.GetCanonicalFork().IsClientReady(client),
+		IsMirror:          client.IsMirror(),
 		CustodyGroupCount: int(client.GetCustodyGroupCount()),
 	}
 
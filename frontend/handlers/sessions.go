@@ -11,6 +11,8 @@ import (
 type SessionsPage struct {
 	Sessions     []*SessionsPageSession `json:"sessions"`
 	SessionCount uint64                 `json:"session_count"`
+	Subnets      []*SessionsPageSubnet  `json:"subnets"`
+	SubnetCount  uint64                 `json:"subnet_count"`
 }
 
 type SessionsPageSession struct {
@@ -20,10 +22,21 @@ type SessionsPageSession struct {
 	LastSeen  string                       `json:"last_seen"`
 	Requests  uint64                       `json:"requests"`
 	Tokens    float64                      `json:"tokens"`
+	Subnet    string                       `json:"subnet"`
 	Target    string                       `json:"target"`
 	Targets   []*SessionsPageSessionTarget `json:"targets"`
 }
 
+type SessionsPageSubnet struct {
+	Index     int     `json:"index"`
+	Prefix    string  `json:"prefix"`
+	FirstSeen string  `json:"first_seen"`
+	LastSeen  string  `json:"last_seen"`
+	Clients   int64   `json:"clients"`
+	Requests  uint64  `json:"requests"`
+	Tokens    float64 `json:"tokens"`
+}
+
 type SessionsPageSessionTarget struct {
 	Prefix string `json:"prefix"`
 	Target string `json:"target"`
@@ -54,12 +67,13 @@ func (fh *FrontendHandler) Sessions(w http.ResponseWriter, r *http.Request) {
 func (fh *FrontendHandler) getSessionsPageData() (*SessionsPage, error) {
 	pageData := &SessionsPage{
 		Sessions: []*SessionsPageSession{},
+		Subnets:  []*SessionsPageSubnet{},
 	}
 
 	for index, group := range fh.proxy.GetSessionGroups() {
 		sessionData := &SessionsPageSession{
 			Index:     index + 1,
-			Key:       group.GetIPAddr(),
+			Key:       group.GetKey(),
 			FirstSeen: group.GetFirstSeen().Format("2006-01-02 15:04:05"),
 			LastSeen:  group.GetLastSeen().Format("2006-01-02 15:04:05"),
 			Requests:  group.GetRequests(),
@@ -68,6 +82,10 @@ func (fh *FrontendHandler) getSessionsPageData() (*SessionsPage, error) {
 			Targets:   []*SessionsPageSessionTarget{},
 		}
 
+		if subnet := group.GetSubnet(); subnet != nil {
+			sessionData.Subnet = subnet.GetPrefix()
+		}
+
 		for _, session := range group.GetSessions() {
 			prefix := "main"
 			if session.GetPrefix() != pool.UnspecifiedClient {
@@ -96,5 +114,19 @@ func (fh *FrontendHandler) getSessionsPageData() (*SessionsPage, error) {
 
 	pageData.SessionCount = uint64(len(pageData.Sessions))
 
+	for index, subnet := range fh.proxy.GetSubnetBuckets() {
+		pageData.Subnets = append(pageData.Subnets, &SessionsPageSubnet{
+			Index:     index + 1,
+			Prefix:    subnet.GetPrefix(),
+			FirstSeen: subnet.GetFirstSeen().Format("2006-01-02 15:04:05"),
+			LastSeen:  subnet.GetLastSeen().Format("2006-01-02 15:04:05"),
+			Clients:   subnet.GetClients(),
+			Requests:  subnet.GetRequests(),
+			Tokens:    subnet.GetLimiterTokens(),
+		})
+	}
+
+	pageData.SubnetCount = uint64(len(pageData.Subnets))
+
 	return pageData, nil
 }
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ethpandaops/dugtrio/frontend"
+	"github.com/ethpandaops/dugtrio/proxy"
+)
+
+var usagePageRanges = []*UsagePageRange{
+	{Key: "24h", Name: "Last 24 hours", duration: 24 * time.Hour},
+	{Key: "7d", Name: "Last 7 days", duration: 7 * 24 * time.Hour},
+	{Key: "30d", Name: "Last 30 days", duration: 30 * 24 * time.Hour},
+}
+
+type UsagePage struct {
+	Enabled    bool              `json:"enabled"`
+	Range      string            `json:"range"`
+	Ranges     []*UsagePageRange `json:"ranges"`
+	From       string            `json:"from"`
+	To         string            `json:"to"`
+	Identities []*UsagePageEntry `json:"identities"`
+	Aggregated bool              `json:"aggregated"`
+}
+
+type UsagePageRange struct {
+	Key      string `json:"key"`
+	Name     string `json:"name"`
+	duration time.Duration
+}
+
+type UsagePageEntry struct {
+	Name       string            `json:"name"`
+	Requests   uint64            `json:"requests"`
+	Errors     uint64            `json:"errors"`
+	ErrorRate  float64           `json:"error_rate"`
+	BytesOut   string            `json:"bytes_out"`
+	LatencyAvg float64           `json:"latency_avg"`
+	LatencyMax uint64            `json:"latency_max"`
+	Classes    []*UsagePageEntry `json:"classes"`
+	counters   *proxy.UsageCounters
+	classes    map[string]*UsagePageEntry
+}
+
+// Usage will return the "usage" page using a go template
+func (fh *FrontendHandler) Usage(w http.ResponseWriter, r *http.Request) {
+	templateFiles := frontend.LayoutTemplateFiles
+	templateFiles = append(templateFiles, "usage/usage.html")
+	pageTemplate := frontend.GetTemplate(templateFiles...)
+	data := frontend.InitPageData(w, r, "usage", "/usage", "Usage", templateFiles)
+
+	var pageError error
+
+	// the usage of the single identities is only shown to admin api keys, like on the usage api
+	identity, _ := fh.proxy.CheckAuthorization(r)
+	isAdmin := identity != nil && identity.ApiKey != nil && identity.ApiKey.Admin
+
+	data.Data, pageError = fh.getUsagePageData(r.URL.Query().Get("range"), !isAdmin)
+	if pageError != nil {
+		frontend.HandlePageError(w, r, pageError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+
+	if frontend.HandleTemplateError(w, r, "usage.go", "Usage", "", pageTemplate.ExecuteTemplate(w, "layout", data)) != nil {
+		return // an error has occurred and was processed
+	}
+}
+
+func (fh *FrontendHandler) getUsagePageData(rangeKey string, aggregated bool) (*UsagePage, error) {
+	usageRange := usagePageRanges[0]
+
+	for _, pageRange := range usagePageRanges {
+		if pageRange.Key == rangeKey {
+			usageRange = pageRange
+		}
+	}
+
+	now := time.Now().UTC()
+	from := now.Add(-usageRange.duration)
+
+	pageData := &UsagePage{
+		Range:      usageRange.Key,
+		Ranges:     usagePageRanges,
+		From:       from.Format(time.RFC3339),
+		To:         now.Format(time.RFC3339),
+		Identities: []*UsagePageEntry{},
+		Aggregated: aggregated,
+	}
+
+	usageStore := fh.proxy.GetUsageStore()
+	if usageStore == nil {
+		return pageData, nil
+	}
+
+	pageData.Enabled = true
+
+	records, err := usageStore.GetUsage(from, now, "")
+	if err != nil {
+		return nil, err
+	}
+
+	identities := map[string]*UsagePageEntry{}
+
+	for _, record := range records {
+		identityName := record.Identity
+		if aggregated {
+			identityName = "all identities"
+		}
+
+		identity := identities[identityName]
+		if identity == nil {
+			identity = newUsagePageEntry(identityName)
+			identity.classes = map[string]*UsagePageEntry{}
+			identities[identityName] = identity
+			pageData.Identities = append(pageData.Identities, identity)
+		}
+
+		class := identity.classes[record.PathClass]
+		if class == nil {
+			class = newUsagePageEntry(record.PathClass)
+			identity.classes[record.PathClass] = class
+			identity.Classes = append(identity.Classes, class)
+		}
+
+		identity.counters.Add(&record.UsageCounters)
+		class.counters.Add(&record.UsageCounters)
+	}
+
+	for _, identity := range pageData.Identities {
+		identity.fillStats()
+
+		for _, class := range identity.Classes {
+			class.fillStats()
+		}
+
+		sort.Slice(identity.Classes, func(a, b int) bool {
+			return identity.Classes[a].Requests > identity.Classes[b].Requests
+		})
+	}
+
+	sort.Slice(pageData.Identities, func(a, b int) bool {
+		return pageData.Identities[a].Requests > pageData.Identities[b].Requests
+	})
+
+	return pageData, nil
+}
+
+func newUsagePageEntry(name string) *UsagePageEntry {
+	return &UsagePageEntry{
+		Name:     name,
+		Classes:  []*UsagePageEntry{},
+		counters: &proxy.UsageCounters{},
+	}
+}
+
+func (entry *UsagePageEntry) fillStats() {
+	entry.Requests = entry.counters.Requests
+	entry.Errors = entry.counters.Errors
+	entry.BytesOut = formatUsageBytes(entry.counters.BytesOut)
+	entry.LatencyAvg = entry.counters.GetLatencyAvg()
+	entry.LatencyMax = entry.counters.LatencyMax
+
+	if entry.Requests > 0 {
+		entry.ErrorRate = float64(entry.Errors) / float64(entry.Requests)
+	}
+}
+
+func formatUsageBytes(size uint64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(size)
+	unit := 0
+
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%d %v", size, units[unit])
+	}
+
+	return fmt.Sprintf("%.2f %v", value, units[unit])
+}
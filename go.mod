@@ -5,6 +5,7 @@ go 1.25.0
 require (
 	github.com/attestantio/go-eth2-client v0.28.0
 	github.com/donovanhide/eventsource v0.0.0-20210830082556-c59027999da0
+	github.com/golang-jwt/jwt/v5 v5.3.1
 	github.com/gorilla/mux v1.8.1
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/mashingan/smapping v0.1.19
@@ -13,6 +14,7 @@ require (
 	github.com/sirupsen/logrus v1.9.4
 	github.com/tdewolff/minify v2.3.6+incompatible
 	github.com/urfave/negroni v1.0.0
+	go.etcd.io/bbolt v1.4.3
 	golang.org/x/time v0.15.0
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -18,6 +18,25 @@ type ProxyMetrics struct {
 	pathCalls    *prometheus.CounterVec
 	callDuration *prometheus.HistogramVec
 	callStatus   *prometheus.CounterVec
+	hedgedCalls  *prometheus.CounterVec
+	cacheLookups *prometheus.CounterVec
+	coalesced    *prometheus.CounterVec
+
+	eventMuxSubscribers *prometheus.GaugeVec
+	eventMuxConnected   *prometheus.GaugeVec
+	eventMuxEvents      *prometheus.CounterVec
+	eventMuxDropped     *prometheus.CounterVec
+	eventFailovers      *prometheus.CounterVec
+	broadcastCalls      *prometheus.CounterVec
+	bestValueBlocks     *prometheus.CounterVec
+	attestationVotes    *prometheus.CounterVec
+	shadowChecks        *prometheus.CounterVec
+	mirrorCallDuration  *prometheus.HistogramVec
+	mirrorCallStatus    *prometheus.CounterVec
+	mirrorDropped       *prometheus.CounterVec
+	cacheEntries        *prometheus.GaugeVec
+	cacheSize           *prometheus.GaugeVec
+	ipBans              *prometheus.CounterVec
 }
 
 func NewProxyMetrics(beaconPool *pool.BeaconPool) *ProxyMetrics {
@@ -54,6 +73,132 @@ func NewProxyMetrics(beaconPool *pool.BeaconPool) *ProxyMetrics {
 			},
 			[]string{"client", "path", "status"},
 		),
+		hedgedCalls: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dugtrio_hedged_calls_total",
+				Help: "Number of hedged proxy requests by outcome.",
+			},
+			[]string{"path", "result"},
+		),
+		cacheLookups: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dugtrio_cache_lookups_total",
+				Help: "Number of response cache lookups by result.",
+			},
+			[]string{"result"},
+		),
+		coalesced: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dugtrio_coalesced_calls_total",
+				Help: "Number of requests served from a shared in-flight upstream call.",
+			},
+			[]string{"path"},
+		),
+		eventMuxSubscribers: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "dugtrio_event_mux_subscribers",
+				Help: "Number of downstream subscribers per multiplexed event stream.",
+			},
+			[]string{"topics"},
+		),
+		eventMuxConnected: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "dugtrio_event_mux_connected",
+				Help: "Upstream connection state per multiplexed event stream.",
+			},
+			[]string{"topics"},
+		),
+		eventMuxEvents: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dugtrio_event_mux_events_total",
+				Help: "Number of upstream events per multiplexed event stream.",
+			},
+			[]string{"topics"},
+		),
+		eventMuxDropped: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dugtrio_event_mux_dropped_total",
+				Help: "Number of dropped events or slow subscribers per multiplexed event stream.",
+			},
+			[]string{"topics", "reason"},
+		),
+		eventFailovers: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dugtrio_event_stream_failovers_total",
+				Help: "Number of event stream upstream switches.",
+			},
+			[]string{"from", "to"},
+		),
+		broadcastCalls: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dugtrio_broadcast_calls_total",
+				Help: "Number of calls broadcasted to all endpoints by result.",
+			},
+			[]string{"path", "result"},
+		),
+		bestValueBlocks: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dugtrio_best_value_blocks_total",
+				Help: "Number of selected best value block proposals by endpoint.",
+			},
+			[]string{"endpoint"},
+		),
+		attestationVotes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dugtrio_attestation_votes_total",
+				Help: "Number of attestation data votes by endpoint and agreement with the majority.",
+			},
+			[]string{"endpoint", "result"},
+		),
+		shadowChecks: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dugtrio_shadow_checks_total",
+				Help: "Number of shadow consistency checks by endpoint pair, path and result.",
+			},
+			[]string{"primary", "shadow", "path", "result"},
+		),
+		mirrorCallDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: "dugtrio_mirror_call_time",
+				Help: "Duration of mirrored requests.",
+			},
+			[]string{"client", "path"},
+		),
+		mirrorCallStatus: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dugtrio_mirror_call_status_total",
+				Help: "Number of mirrored requests per mirror client and status (0 = request failed).",
+			},
+			[]string{"client", "path", "status"},
+		),
+		mirrorDropped: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dugtrio_mirror_dropped_total",
+				Help: "Number of mirror calls that were dropped because too many mirror calls are in flight.",
+			},
+			[]string{"client"},
+		),
+		cacheEntries: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "dugtrio_cache_entries",
+				Help: "Number of entries in the response cache per tier.",
+			},
+			[]string{"tier"},
+		),
+		cacheSize: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "dugtrio_cache_size_bytes",
+				Help: "Size of the response cache per tier.",
+			},
+			[]string{"tier"},
+		),
+		ipBans: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dugtrio_ip_bans_total",
+				Help: "Number of banned client IPs by reason.",
+			},
+			[]string{"reason"},
+		),
 	}
 
 	err := prometheus.Register(proxyMetrics.totalCalls)
@@ -81,6 +226,96 @@ func NewProxyMetrics(beaconPool *pool.BeaconPool) *ProxyMetrics {
 		logrus.Errorf("error registering call status metric: %v", err)
 	}
 
+	err = prometheus.Register(proxyMetrics.hedgedCalls)
+	if err != nil {
+		logrus.Errorf("error registering hedged calls metric: %v", err)
+	}
+
+	err = prometheus.Register(proxyMetrics.cacheLookups)
+	if err != nil {
+		logrus.Errorf("error registering cache lookups metric: %v", err)
+	}
+
+	err = prometheus.Register(proxyMetrics.coalesced)
+	if err != nil {
+		logrus.Errorf("error registering coalesced calls metric: %v", err)
+	}
+
+	err = prometheus.Register(proxyMetrics.eventMuxSubscribers)
+	if err != nil {
+		logrus.Errorf("error registering event mux subscribers metric: %v", err)
+	}
+
+	err = prometheus.Register(proxyMetrics.eventMuxConnected)
+	if err != nil {
+		logrus.Errorf("error registering event mux connected metric: %v", err)
+	}
+
+	err = prometheus.Register(proxyMetrics.eventMuxEvents)
+	if err != nil {
+		logrus.Errorf("error registering event mux events metric: %v", err)
+	}
+
+	err = prometheus.Register(proxyMetrics.eventMuxDropped)
+	if err != nil {
+		logrus.Errorf("error registering event mux dropped metric: %v", err)
+	}
+
+	err = prometheus.Register(proxyMetrics.eventFailovers)
+	if err != nil {
+		logrus.Errorf("error registering event stream failovers metric: %v", err)
+	}
+
+	err = prometheus.Register(proxyMetrics.broadcastCalls)
+	if err != nil {
+		logrus.Errorf("error registering broadcast calls metric: %v", err)
+	}
+
+	err = prometheus.Register(proxyMetrics.bestValueBlocks)
+	if err != nil {
+		logrus.Errorf("error registering best value blocks metric: %v", err)
+	}
+
+	err = prometheus.Register(proxyMetrics.attestationVotes)
+	if err != nil {
+		logrus.Errorf("error registering attestation votes metric: %v", err)
+	}
+
+	err = prometheus.Register(proxyMetrics.shadowChecks)
+	if err != nil {
+		logrus.Errorf("error registering shadow checks metric: %v", err)
+	}
+
+	err = prometheus.Register(proxyMetrics.mirrorCallDuration)
+	if err != nil {
+		logrus.Errorf("error registering mirror call duration metric: %v", err)
+	}
+
+	err = prometheus.Register(proxyMetrics.mirrorCallStatus)
+	if err != nil {
+		logrus.Errorf("error registering mirror call status metric: %v", err)
+	}
+
+	err = prometheus.Register(proxyMetrics.mirrorDropped)
+	if err != nil {
+		logrus.Errorf("error registering mirror dropped metric: %v", err)
+	}
+
+	err = prometheus.Register(proxyMetrics.cacheEntries)
+	if err != nil {
+		logrus.Errorf("error registering cache entries metric: %v", err)
+	}
+
+	err = prometheus.Register(proxyMetrics.cacheSize)
+	if err != nil {
+		logrus.Errorf("error registering cache size metric: %v", err)
+	}
+
+	err = prometheus.Register(proxyMetrics.ipBans)
+	if err != nil {
+		logrus.Errorf("error registering ip bans metric: %v", err)
+	}
+
 	err = prometheus.Register(prometheus.NewGaugeFunc(
 		prometheus.GaugeOpts{
 			Name: "dugtrio_pool_online",
@@ -99,6 +334,11 @@ func NewProxyMetrics(beaconPool *pool.BeaconPool) *ProxyMetrics {
 		logrus.Errorf("error registering pool online metric: %v", err)
 	}
 
+	err = prometheus.Register(newTransportCollector(beaconPool))
+	if err != nil {
+		logrus.Errorf("error registering endpoint transport metrics: %v", err)
+	}
+
 	return proxyMetrics
 }
 
@@ -123,6 +363,145 @@ func (proxyMetrics *ProxyMetrics) AddCall(clientName, apiPath string, callDurati
 	}).Inc()
 }
 
+func (proxyMetrics *ProxyMetrics) AddMirrorCall(clientName, apiPath string, callDuration time.Duration, callStatus int) {
+	trimmedPath := proxyMetrics.trimAPIPath(apiPath)
+
+	proxyMetrics.mirrorCallDuration.With(prometheus.Labels{
+		"client": clientName,
+		"path":   trimmedPath,
+	}).Observe(float64(callDuration.Milliseconds()) / 1000)
+	proxyMetrics.mirrorCallStatus.With(prometheus.Labels{
+		"client": clientName,
+		"path":   trimmedPath,
+		"status": fmt.Sprintf("%v", callStatus),
+	}).Inc()
+}
+
+func (proxyMetrics *ProxyMetrics) AddMirrorDropped(clientName string) {
+	proxyMetrics.mirrorDropped.With(prometheus.Labels{
+		"client": clientName,
+	}).Inc()
+}
+
+func (proxyMetrics *ProxyMetrics) AddHedgedCall(apiPath string, hedged, hedgeWon bool) {
+	result := "not_hedged"
+
+	switch {
+	case hedgeWon:
+		result = "hedge_won"
+	case hedged:
+		result = "primary_won"
+	}
+
+	proxyMetrics.hedgedCalls.With(prometheus.Labels{
+		"path":   proxyMetrics.trimAPIPath(apiPath),
+		"result": result,
+	}).Inc()
+}
+
+func (proxyMetrics *ProxyMetrics) AddCacheLookup(result string) {
+	proxyMetrics.cacheLookups.With(prometheus.Labels{
+		"result": result,
+	}).Inc()
+}
+
+func (proxyMetrics *ProxyMetrics) AddCoalescedCall(apiPath string) {
+	proxyMetrics.coalesced.With(prometheus.Labels{
+		"path": proxyMetrics.trimAPIPath(apiPath),
+	}).Inc()
+}
+
+func (proxyMetrics *ProxyMetrics) SetEventMuxSubscribers(topics string, subscribers int) {
+	proxyMetrics.eventMuxSubscribers.With(prometheus.Labels{
+		"topics": topics,
+	}).Set(float64(subscribers))
+}
+
+func (proxyMetrics *ProxyMetrics) SetEventMuxStreamConnected(topics string, connected bool) {
+	value := 0.0
+	if connected {
+		value = 1
+	}
+
+	proxyMetrics.eventMuxConnected.With(prometheus.Labels{
+		"topics": topics,
+	}).Set(value)
+}
+
+func (proxyMetrics *ProxyMetrics) AddEventMuxEvent(topics string) {
+	proxyMetrics.eventMuxEvents.With(prometheus.Labels{
+		"topics": topics,
+	}).Inc()
+}
+
+func (proxyMetrics *ProxyMetrics) AddEventMuxDropped(topics, reason string) {
+	proxyMetrics.eventMuxDropped.With(prometheus.Labels{
+		"topics": topics,
+		"reason": reason,
+	}).Inc()
+}
+
+func (proxyMetrics *ProxyMetrics) AddEventStreamFailover(fromClient, toClient string) {
+	proxyMetrics.eventFailovers.With(prometheus.Labels{
+		"from": fromClient,
+		"to":   toClient,
+	}).Inc()
+}
+
+func (proxyMetrics *ProxyMetrics) AddBroadcastCall(path, result string) {
+	proxyMetrics.broadcastCalls.With(prometheus.Labels{
+		"path":   proxyMetrics.trimAPIPath(path),
+		"result": result,
+	}).Inc()
+}
+
+func (proxyMetrics *ProxyMetrics) AddBestValueBlock(endpoint string) {
+	proxyMetrics.bestValueBlocks.With(prometheus.Labels{
+		"endpoint": endpoint,
+	}).Inc()
+}
+
+func (proxyMetrics *ProxyMetrics) AddAttestationVote(endpoint string, agreed bool) {
+	result := "agree"
+	if !agreed {
+		result = "disagree"
+	}
+
+	proxyMetrics.attestationVotes.With(prometheus.Labels{
+		"endpoint": endpoint,
+		"result":   result,
+	}).Inc()
+}
+
+func (proxyMetrics *ProxyMetrics) AddShadowCheck(primary, shadow, path, result string) {
+	proxyMetrics.shadowChecks.With(prometheus.Labels{
+		"primary": primary,
+		"shadow":  shadow,
+		"path":    path,
+		"result":  result,
+	}).Inc()
+}
+
+func (proxyMetrics *ProxyMetrics) RemoveEventMuxStream(topics string) {
+	proxyMetrics.eventMuxSubscribers.DeleteLabelValues(topics)
+	proxyMetrics.eventMuxConnected.DeleteLabelValues(topics)
+}
+
+func (proxyMetrics *ProxyMetrics) SetCacheSize(tier string, entries int, size int64) {
+	proxyMetrics.cacheEntries.With(prometheus.Labels{
+		"tier": tier,
+	}).Set(float64(entries))
+	proxyMetrics.cacheSize.With(prometheus.Labels{
+		"tier": tier,
+	}).Set(float64(size))
+}
+
+func (proxyMetrics *ProxyMetrics) AddIPBan(reason string) {
+	proxyMetrics.ipBans.With(prometheus.Labels{
+		"reason": reason,
+	}).Inc()
+}
+
 func (proxyMetrics *ProxyMetrics) trimAPIPath(apiPath string) string {
 	if queryPos := strings.Index(apiPath, "?"); queryPos > -1 {
 		apiPath = apiPath[:queryPos]
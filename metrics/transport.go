@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ethpandaops/dugtrio/pool"
+)
+
+// transportCollector exposes the connection pool statistics of all endpoints.
+type transportCollector struct {
+	beaconPool     *pool.BeaconPool
+	openConns      *prometheus.Desc
+	activeRequests *prometheus.Desc
+	dials          *prometheus.Desc
+	acquiredConns  *prometheus.Desc
+}
+
+func newTransportCollector(beaconPool *pool.BeaconPool) *transportCollector {
+	return &transportCollector{
+		beaconPool: beaconPool,
+		openConns: prometheus.NewDesc(
+			"dugtrio_endpoint_connections_open",
+			"Number of open connections per endpoint.",
+			[]string{"endpoint"}, nil,
+		),
+		activeRequests: prometheus.NewDesc(
+			"dugtrio_endpoint_requests_active",
+			"Number of active requests per endpoint (including open event streams).",
+			[]string{"endpoint"}, nil,
+		),
+		dials: prometheus.NewDesc(
+			"dugtrio_endpoint_dials_total",
+			"Number of connection attempts per endpoint by result.",
+			[]string{"endpoint", "result"}, nil,
+		),
+		acquiredConns: prometheus.NewDesc(
+			"dugtrio_endpoint_connections_acquired_total",
+			"Number of connections acquired for requests per endpoint, by whether an idle connection was reused.",
+			[]string{"endpoint", "reused"}, nil,
+		),
+	}
+}
+
+func (collector *transportCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.openConns
+	ch <- collector.activeRequests
+	ch <- collector.dials
+	ch <- collector.acquiredConns
+}
+
+func (collector *transportCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, client := range collector.beaconPool.GetAllEndpoints() {
+		name := client.GetName()
+		stats := client.GetTransportStats()
+
+		ch <- prometheus.MustNewConstMetric(collector.openConns, prometheus.GaugeValue, float64(stats.OpenConns), name)
+		ch <- prometheus.MustNewConstMetric(collector.activeRequests, prometheus.GaugeValue, float64(stats.ActiveRequests), name)
+		ch <- prometheus.MustNewConstMetric(collector.dials, prometheus.CounterValue, float64(stats.Dials), name, "success")
+		ch <- prometheus.MustNewConstMetric(collector.dials, prometheus.CounterValue, float64(stats.DialErrors), name, "error")
+		ch <- prometheus.MustNewConstMetric(collector.acquiredConns, prometheus.CounterValue, float64(stats.NewConns), name, "false")
+		ch <- prometheus.MustNewConstMetric(collector.acquiredConns, prometheus.CounterValue, float64(stats.ReusedConns), name, "true")
+	}
+}
@@ -98,6 +98,63 @@ func (pool *BeaconPool) GetReadyEndpoint(clientType ClientType, minCgc uint16) *
 	return selectedClient
 }
 
+// GetReadyEndpointWithFilter returns a ready client like GetReadyEndpoint, but only considers clients accepted by the filter.
+func (pool *BeaconPool) GetReadyEndpointWithFilter(clientType ClientType, minCgc uint16, filter func(*Client) bool) *Client {
+	canonicalFork := pool.GetCanonicalFork()
+	if canonicalFork == nil {
+		return nil
+	}
+
+	readyClients := make([]*Client, 0, len(canonicalFork.ReadyClients))
+
+	for _, client := range canonicalFork.ReadyClients {
+		if filter(client) {
+			readyClients = append(readyClients, client)
+		}
+	}
+
+	if len(readyClients) == 0 {
+		return nil
+	}
+
+	return pool.runClientScheduler(readyClients, clientType, minCgc)
+}
+
+// GetReadyEndpoints returns all ready clients of the canonical fork that match the
+// given client type and minimum custody group count.
+func (pool *BeaconPool) GetReadyEndpoints(clientType ClientType, minCgc uint16) []*Client {
+	canonicalFork := pool.GetCanonicalFork()
+	if canonicalFork == nil {
+		return nil
+	}
+
+	clients := make([]*Client, 0, len(canonicalFork.ReadyClients))
+
+	for _, client := range canonicalFork.ReadyClients {
+		if clientType != UnspecifiedClient && clientType != client.clientType {
+			continue
+		}
+
+		if client.GetCustodyGroupCount() < minCgc {
+			continue
+		}
+
+		clients = append(clients, client)
+	}
+
+	return clients
+}
+
+// GetMirrorEndpoints returns all ready mirror clients of the canonical fork.
+func (pool *BeaconPool) GetMirrorEndpoints() []*Client {
+	canonicalFork := pool.GetCanonicalFork()
+	if canonicalFork == nil {
+		return nil
+	}
+
+	return canonicalFork.MirrorClients
+}
+
 func (pool *BeaconPool) IsClientReady(client *Client) bool {
 	if client == nil {
 		return false
@@ -2,6 +2,7 @@ package pool
 
 import (
 	"context"
+	"net/http"
 	"sync"
 	"time"
 
@@ -82,6 +83,30 @@ func (client *Client) GetEndpointConfig() *types.EndpointConfig {
 	return client.endpointConfig
 }
 
+// IsMirror returns true for mirror endpoints, which only receive copies of calls and never serve them.
+func (client *Client) IsMirror() bool {
+	return client.endpointConfig.Mirror
+}
+
+// GetHTTPClient returns a http client that uses the transport settings of the endpoint.
+func (client *Client) GetHTTPClient() *http.Client {
+	return client.rpcClient.GetHTTPClient()
+}
+
+// GetTransportStats returns the connection pool statistics of the endpoint.
+func (client *Client) GetTransportStats() rpc.TransportStats {
+	return client.rpcClient.GetTransportStats()
+}
+
+func (client *Client) GetLabels() []string {
+	return client.endpointConfig.Labels
+}
+
+// NewEventStream opens a new beacon event stream for the given rpc.Stream* event flags.
+func (client *Client) NewEventStream(events uint16) *rpc.BeaconStream {
+	return client.rpcClient.NewBlockStream(events)
+}
+
 func (client *Client) GetLastHead() (phase0.Slot, phase0.Root) {
 	client.headMutex.RLock()
 	defer client.headMutex.RUnlock()
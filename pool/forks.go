@@ -12,6 +12,8 @@ type HeadFork struct {
 	Root         phase0.Root
 	ReadyClients []*Client
 	AllClients   []*Client
+	// MirrorClients are ready mirror endpoints, they are excluded from ReadyClients
+	MirrorClients []*Client
 }
 
 func (pool *BeaconPool) resetHeadForkCache() {
@@ -74,6 +76,7 @@ func (pool *BeaconPool) GetHeadForks() []*HeadFork {
 
 	for _, fork := range headForks {
 		fork.ReadyClients = make([]*Client, 0)
+		fork.MirrorClients = make([]*Client, 0)
 		for _, client := range fork.AllClients {
 			if client.GetStatus() != ClientStatusOnline {
 				continue
@@ -86,7 +89,13 @@ func (pool *BeaconPool) GetHeadForks() []*HeadFork {
 				_, headDistance = pool.blockCache.GetBlockDistance(cHeadRoot, fork.Root)
 			}
 
-			if headDistance <= pool.config.MaxHeadDistance {
+			if headDistance > pool.config.MaxHeadDistance {
+				continue
+			}
+
+			if client.IsMirror() {
+				fork.MirrorClients = append(fork.MirrorClients, client)
+			} else {
 				fork.ReadyClients = append(fork.ReadyClients, client)
 			}
 		}
@@ -0,0 +1,297 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ethpandaops/dugtrio/pool"
+	"github.com/ethpandaops/dugtrio/types"
+)
+
+const (
+	accessActionAllow       = "allow"
+	accessActionDeny        = "deny"
+	accessActionRequireAuth = "require-auth"
+)
+
+// accessRuleSet is an ordered list of access rules, the first matching rule decides about a call.
+type accessRuleSet struct {
+	defaultAction string
+	rules         []*accessRule
+}
+
+type accessRule struct {
+	action        string
+	methods       []string
+	path          *regexp.Regexp
+	query         map[string]*regexp.Regexp
+	headers       map[string]*regexp.Regexp
+	identities    []string
+	authenticated *bool
+	message       string
+}
+
+// accessRules holds the main rule set and the rule sets of client specific endpoints.
+// Blocked paths are denied before any rule set is evaluated.
+type accessRules struct {
+	blocked  *accessRuleSet
+	main     *accessRuleSet
+	prefixes map[pool.ClientType]*accessRuleSet
+}
+
+func (proxy *BeaconProxy) compileAccessRules(config *types.ProxyConfig) *accessRules {
+	rules := &accessRules{
+		blocked: &accessRuleSet{
+			defaultAction: accessActionAllow,
+		},
+		prefixes: map[pool.ClientType]*accessRuleSet{},
+	}
+
+	for _, blockedPath := range proxy.compilePathPatterns(config.BlockedPaths, config.BlockedPathsStr) {
+		rules.blocked.rules = append(rules.blocked.rules, &accessRule{
+			action:  accessActionDeny,
+			path:    blockedPath,
+			message: "Path Blocked",
+		})
+	}
+
+	if config.AccessRules == nil {
+		return rules
+	}
+
+	rules.main = proxy.compileAccessRuleSet(config.AccessRules)
+
+	for prefix, prefixRules := range config.AccessRules.Prefixes {
+		clientType := pool.ParseClientType(strings.ToLower(prefix))
+		if clientType == pool.UnknownClient {
+			proxy.logger.Errorf("error parsing access rules: unknown client prefix '%v'", prefix)
+			continue
+		}
+
+		rules.prefixes[clientType] = proxy.compileAccessRuleSet(prefixRules)
+	}
+
+	return rules
+}
+
+func (proxy *BeaconProxy) compileAccessRuleSet(config *types.AccessRulesConfig) *accessRuleSet {
+	ruleSet := &accessRuleSet{
+		defaultAction: accessActionAllow,
+		rules:         make([]*accessRule, 0, len(config.Rules)),
+	}
+
+	switch config.DefaultAction {
+	case "", accessActionAllow:
+	case accessActionDeny:
+		ruleSet.defaultAction = accessActionDeny
+	default:
+		proxy.logger.Errorf("error parsing access rules: unknown default action '%v', using allow", config.DefaultAction)
+	}
+
+	for idx, ruleConfig := range config.Rules {
+		rule, err := compileAccessRule(ruleConfig)
+		if err != nil {
+			// skipping an allow rule is safe, skipping a deny rule is not
+			proxy.logger.Errorf("error parsing access rule %v: %v", idx, err)
+
+			rule = &accessRule{
+				action:  accessActionDeny,
+				message: "Access rule misconfigured",
+			}
+		}
+
+		ruleSet.rules = append(ruleSet.rules, rule)
+	}
+
+	return ruleSet
+}
+
+func compileAccessRule(config *types.AccessRuleConfig) (*accessRule, error) {
+	rule := &accessRule{
+		action:        config.Action,
+		identities:    config.Identities,
+		authenticated: config.Authenticated,
+		message:       config.Message,
+	}
+
+	switch config.Action {
+	case accessActionAllow, accessActionDeny, accessActionRequireAuth:
+	default:
+		return nil, fmt.Errorf("unknown action '%v'", config.Action)
+	}
+
+	for _, method := range config.Methods {
+		rule.methods = append(rule.methods, strings.ToUpper(method))
+	}
+
+	if config.Path != "" {
+		pathPattern, err := regexp.Compile(config.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path pattern: %w", err)
+		}
+
+		rule.path = pathPattern
+	}
+
+	var err error
+
+	rule.query, err = compileAccessValuePatterns(config.Query, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query pattern: %w", err)
+	}
+
+	rule.headers, err = compileAccessValuePatterns(config.Headers, true)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header pattern: %w", err)
+	}
+
+	return rule, nil
+}
+
+func compileAccessValuePatterns(patterns map[string]string, canonicalKeys bool) (map[string]*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	compiled := make(map[string]*regexp.Regexp, len(patterns))
+
+	for key, pattern := range patterns {
+		if canonicalKeys {
+			key = http.CanonicalHeaderKey(key)
+		}
+
+		if pattern == "" {
+			compiled[key] = nil
+			continue
+		}
+
+		valuePattern, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", key, err)
+		}
+
+		compiled[key] = valuePattern
+	}
+
+	return compiled, nil
+}
+
+// checkAccessRules evaluates the access rules for a call. Returns the error response for denied calls, or nil if the call is allowed.
+func (proxy *BeaconProxy) checkAccessRules(r *http.Request, identity *AuthIdentity, prefix pool.ClientType) *apiErrorResponse {
+	if errorResponse := proxy.accessRules.blocked.check(r, identity); errorResponse != nil {
+		return errorResponse
+	}
+
+	ruleSet := proxy.accessRules.prefixes[prefix]
+	if ruleSet == nil {
+		ruleSet = proxy.accessRules.main
+	}
+
+	if ruleSet == nil {
+		return nil
+	}
+
+	return ruleSet.check(r, identity)
+}
+
+func (ruleSet *accessRuleSet) check(r *http.Request, identity *AuthIdentity) *apiErrorResponse {
+	for _, rule := range ruleSet.rules {
+		if !rule.matches(r, identity) {
+			continue
+		}
+
+		return rule.getErrorResponse(identity)
+	}
+
+	if ruleSet.defaultAction == accessActionDeny {
+		return &apiErrorResponse{
+			Code:    http.StatusForbidden,
+			Message: "Access denied",
+		}
+	}
+
+	return nil
+}
+
+func (rule *accessRule) matches(r *http.Request, identity *AuthIdentity) bool {
+	if len(rule.methods) > 0 && !slices.Contains(rule.methods, r.Method) {
+		return false
+	}
+
+	if rule.path != nil && !rule.path.MatchString(r.URL.EscapedPath()) {
+		return false
+	}
+
+	if rule.authenticated != nil && *rule.authenticated != (identity != nil) {
+		return false
+	}
+
+	if len(rule.identities) > 0 && (identity == nil || !slices.Contains(rule.identities, identity.Name)) {
+		return false
+	}
+
+	if len(rule.query) > 0 {
+		query := r.URL.Query()
+
+		for key, pattern := range rule.query {
+			if !matchAccessValues(query[key], pattern) {
+				return false
+			}
+		}
+	}
+
+	for key, pattern := range rule.headers {
+		if !matchAccessValues(r.Header.Values(key), pattern) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchAccessValues checks if any of the values matches the pattern. A nil pattern only requires a value to be present.
+func matchAccessValues(values []string, pattern *regexp.Regexp) bool {
+	if pattern == nil {
+		return len(values) > 0
+	}
+
+	for _, value := range values {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (rule *accessRule) getErrorResponse(identity *AuthIdentity) *apiErrorResponse {
+	switch rule.action {
+	case accessActionRequireAuth:
+		if identity != nil {
+			return nil
+		}
+
+		return &apiErrorResponse{
+			Code:    http.StatusUnauthorized,
+			Message: rule.getMessage("Authentication required"),
+		}
+	case accessActionDeny:
+		return &apiErrorResponse{
+			Code:    http.StatusForbidden,
+			Message: rule.getMessage("Access denied"),
+		}
+	default:
+		return nil
+	}
+}
+
+func (rule *accessRule) getMessage(defaultMessage string) string {
+	if rule.message != "" {
+		return rule.message
+	}
+
+	return defaultMessage
+}
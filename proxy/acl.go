@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+
+	"github.com/ethpandaops/dugtrio/pool"
+	"github.com/ethpandaops/dugtrio/types"
+)
+
+var errEndpointNotAllowed = errors.New("endpoint not allowed for this identity")
+
+// accessControl restricts the paths and endpoints an identity may use.
+type accessControl struct {
+	blocked      bool
+	paths        []*regexp.Regexp
+	invalidPaths bool
+	endpoints    []string
+	labels       []string
+	clientTypes  []pool.ClientType
+}
+
+func (proxy *BeaconProxy) compileAccessControl(config *types.ApiKeyACL) *accessControl {
+	acl := &accessControl{
+		blocked:   config.Blocked,
+		paths:     proxy.compilePathPatterns(config.AllowedPaths, ""),
+		endpoints: config.AllowedEndpoints,
+		labels:    config.AllowedLabels,
+	}
+
+	// an invalid pattern must not widen the access of the key
+	acl.invalidPaths = len(acl.paths) < len(config.AllowedPaths)
+
+	for _, clientTypeName := range config.AllowedClientTypes {
+		clientType := pool.ParseClientType(clientTypeName)
+		if clientType == pool.UnknownClient {
+			proxy.logger.Errorf("error parsing api key acl: unknown client type '%v'", clientTypeName)
+		}
+
+		// unknown client types are kept, so the restriction stays in place
+		acl.clientTypes = append(acl.clientTypes, clientType)
+	}
+
+	return acl
+}
+
+// compileApiKeyACLs compiles the access control of all configured api keys.
+func (proxy *BeaconProxy) compileApiKeyACLs() map[*types.ApiKey]*accessControl {
+	acls := map[*types.ApiKey]*accessControl{}
+
+	if proxy.config.Auth == nil {
+		return acls
+	}
+
+	for idx := range proxy.config.Auth.ApiKeys {
+		apiKey := &proxy.config.Auth.ApiKeys[idx]
+		acls[apiKey] = proxy.compileAccessControl(&apiKey.ApiKeyACL)
+	}
+
+	return acls
+}
+
+// checkCall returns the error response if the identity may not make the call.
+func (acl *accessControl) checkCall(r *http.Request, prefix pool.ClientType) *apiErrorResponse {
+	if acl.blocked {
+		return &apiErrorResponse{
+			Code:    http.StatusForbidden,
+			Message: "Access blocked for this identity",
+		}
+	}
+
+	if len(acl.paths) > 0 || acl.invalidPaths {
+		allowed := false
+
+		for _, pathPattern := range acl.paths {
+			if pathPattern.MatchString(r.URL.EscapedPath()) {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return &apiErrorResponse{
+				Code:    http.StatusForbidden,
+				Message: "Path not allowed for this identity",
+			}
+		}
+	}
+
+	if prefix != pool.UnspecifiedClient && !acl.isClientTypeAllowed(prefix) {
+		return &apiErrorResponse{
+			Code:    http.StatusForbidden,
+			Message: "Client type not allowed for this identity",
+		}
+	}
+
+	return nil
+}
+
+// restrictsEndpoints returns true if only some of the endpoints may serve the calls of the identity.
+func (acl *accessControl) restrictsEndpoints() bool {
+	return len(acl.endpoints) > 0 || len(acl.labels) > 0 || len(acl.clientTypes) > 0
+}
+
+func (acl *accessControl) isClientTypeAllowed(clientType pool.ClientType) bool {
+	return len(acl.clientTypes) == 0 || slices.Contains(acl.clientTypes, clientType)
+}
+
+func (acl *accessControl) isEndpointAllowed(client *pool.Client) bool {
+	if len(acl.endpoints) > 0 && !slices.Contains(acl.endpoints, client.GetName()) {
+		return false
+	}
+
+	if len(acl.labels) > 0 && !slices.ContainsFunc(client.GetLabels(), func(label string) bool {
+		return slices.Contains(acl.labels, label)
+	}) {
+		return false
+	}
+
+	return acl.isClientTypeAllowed(client.GetClientType())
+}
+
+// isEndpointRestricted returns true if only some of the endpoints may serve the calls of the session group.
+// Shared upstream calls (coalescing, event multiplexing) are not used for restricted groups.
+func (group *SessionGroup) isEndpointRestricted() bool {
+	return group.acl != nil && group.acl.restrictsEndpoints()
+}
+
+func (group *SessionGroup) isEndpointAllowed(client *pool.Client) bool {
+	return group.acl == nil || group.acl.isEndpointAllowed(client)
+}
+
+// filterEndpoints returns the endpoints that may serve the calls of the session group.
+func (group *SessionGroup) filterEndpoints(clients []*pool.Client) []*pool.Client {
+	if !group.isEndpointRestricted() {
+		return clients
+	}
+
+	allowed := make([]*pool.Client, 0, len(clients))
+
+	for _, client := range clients {
+		if group.acl.isEndpointAllowed(client) {
+			allowed = append(allowed, client)
+		}
+	}
+
+	return allowed
+}
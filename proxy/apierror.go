@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// apiErrorResponse is an error response in the Beacon API error format.
+type apiErrorResponse struct {
+	Code     int               `json:"code"`
+	Message  string            `json:"message"`
+	Failures []apiIndexedError `json:"failures,omitempty"`
+}
+
+type apiIndexedError struct {
+	Index   int    `json:"index"`
+	Message string `json:"message"`
+}
+
+func (proxy *BeaconProxy) writeAPIError(w http.ResponseWriter, response *apiErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(response.Code)
+
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		proxy.logger.Warnf("error writing api error response: %v", err)
+	}
+}
+
+// parseAPIError extracts the error from an upstream error response.
+// Responses that are not in the Beacon API error format are returned as plain message.
+func parseAPIError(status int, body []byte) *apiErrorResponse {
+	response := &apiErrorResponse{}
+
+	err := json.Unmarshal(body, response)
+	if err != nil || response.Message == "" {
+		message := strings.TrimSpace(string(body))
+		if len(message) > 256 {
+			message = message[:256] + "..."
+		}
+
+		response.Message = message
+	}
+
+	response.Code = status
+
+	return response
+}
@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ethpandaops/dugtrio/pool"
+	"github.com/ethpandaops/dugtrio/utils"
+)
+
+var attestationDataPattern = regexp.MustCompile(`^/eth/v[0-9]+/validator/attestation_data$`)
+
+type attestationCheckpoint struct {
+	Epoch string `json:"epoch"`
+	Root  string `json:"root"`
+}
+
+type attestationDataResponse struct {
+	Data struct {
+		Slot            string                `json:"slot"`
+		BeaconBlockRoot string                `json:"beacon_block_root"`
+		Source          attestationCheckpoint `json:"source"`
+		Target          attestationCheckpoint `json:"target"`
+	} `json:"data"`
+}
+
+// attestationVote is the attestation data returned by one of the endpoints.
+type attestationVote struct {
+	result *fanoutResult
+	key    string
+}
+
+// attestationVoting collects the attestation data votes of all endpoints.
+type attestationVoting struct {
+	total  int
+	votes  []*attestationVote
+	failed []*fanoutResult
+	counts map[string]int
+}
+
+func (proxy *BeaconProxy) isAttestationConsensusCall(r *http.Request) bool {
+	if proxy.config.AttestationConsensus == nil || !proxy.config.AttestationConsensus.Enabled {
+		return false
+	}
+
+	if r.Method != http.MethodGet || hasNextEndpointOverride(r) {
+		return false
+	}
+
+	return attestationDataPattern.MatchString(r.URL.EscapedPath())
+}
+
+// getAttestationVoteKey returns the voted beacon block root, source & target of the attestation data response.
+func getAttestationVoteKey(body []byte) (string, error) {
+	response := &attestationDataResponse{}
+
+	err := json.Unmarshal(body, response)
+	if err != nil {
+		return "", fmt.Errorf("error parsing attestation data: %w", err)
+	}
+
+	data := &response.Data
+
+	return fmt.Sprintf("head %v, source %v/%v, target %v/%v", data.BeaconBlockRoot, data.Source.Epoch, data.Source.Root, data.Target.Epoch, data.Target.Root), nil
+}
+
+func (voting *attestationVoting) addResult(result *fanoutResult) {
+	if !result.isSuccess() {
+		voting.failed = append(voting.failed, result)
+		return
+	}
+
+	key, err := getAttestationVoteKey(result.body)
+	if err != nil {
+		result.err = err
+		voting.failed = append(voting.failed, result)
+
+		return
+	}
+
+	voting.votes = append(voting.votes, &attestationVote{
+		result: result,
+		key:    key,
+	})
+	voting.counts[key]++
+}
+
+// getMajority returns the first received vote of the attestation data with the most votes.
+func (voting *attestationVoting) getMajority() (*attestationVote, int) {
+	var majority *attestationVote
+
+	for _, vote := range voting.votes {
+		if majority == nil || voting.counts[vote.key] > voting.counts[majority.key] {
+			majority = vote
+		}
+	}
+
+	if majority == nil {
+		return nil, 0
+	}
+
+	return majority, voting.counts[majority.key]
+}
+
+// getVoteSplit returns the number of votes per attestation data, sorted by votes.
+func (voting *attestationVoting) getVoteSplit() string {
+	keys := make([]string, 0, len(voting.counts))
+	for key := range voting.counts {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(a, b int) bool {
+		return voting.counts[keys[a]] > voting.counts[keys[b]]
+	})
+
+	split := make([]string, 0, len(keys))
+	for _, key := range keys {
+		split = append(split, fmt.Sprintf("%d: %v", voting.counts[key], key))
+	}
+
+	return strings.Join(split, "; ")
+}
+
+// processAttestationConsensusCall requests the attestation data from multiple endpoints and returns the majority answer.
+// The response is sent as soon as more than half of the endpoints agree, the remaining votes are still evaluated for metrics.
+func (proxy *BeaconProxy) processAttestationConsensusCall(w http.ResponseWriter, r *http.Request, session *Session, clientType pool.ClientType) {
+	config := proxy.config.AttestationConsensus
+
+	endpoints := proxy.getFanoutEndpoints(session, clientType, config.Endpoints)
+	if len(endpoints) == 0 {
+		proxy.writeAPIError(w, &apiErrorResponse{
+			Code:    http.StatusServiceUnavailable,
+			Message: "No Endpoint available",
+		})
+
+		return
+	}
+
+	// the remaining votes are collected after the response has been sent
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), config.Deadline)
+
+	results := proxy.fanoutCall(ctx, r, nil, endpoints)
+	voting := &attestationVoting{
+		total:  len(endpoints),
+		counts: map[string]int{},
+	}
+
+	var majority *attestationVote
+
+	received := 0
+
+	for received < len(endpoints) {
+		voting.addResult(<-results)
+		received++
+
+		if vote, count := voting.getMajority(); count*2 > len(endpoints) {
+			majority = vote
+			break
+		}
+	}
+
+	hasMajority := majority != nil
+
+	if majority == nil {
+		// no quorum, fall back to the attestation data with the most votes
+		majority, _ = voting.getMajority()
+	}
+
+	if majority == nil {
+		cancel()
+		proxy.writeAPIError(w, getFanoutError("attestation data", voting.failed))
+
+		return
+	}
+
+	if !hasMajority {
+		proxy.logger.WithFields(logrus.Fields{
+			"votes":  voting.getVoteSplit(),
+			"failed": len(voting.failed),
+		}).Warnf("no attestation data majority among %v endpoints, returning the answer with the most votes", len(endpoints))
+	}
+
+	w.Header().Set("X-Dugtrio-Attestation-Votes", fmt.Sprintf("%d/%d", voting.counts[majority.key], len(endpoints)))
+	w.Header().Set("X-Dugtrio-Attestation-Majority", fmt.Sprintf("%v", hasMajority))
+
+	err := proxy.writeFanoutResult(w, session, majority.result)
+	if err != nil {
+		proxy.logger.Debugf("error writing attestation data response: %v", err)
+	}
+
+	go func() {
+		defer utils.HandleSubroutinePanic("proxy.attestationconsensus.finish", nil)
+		defer cancel()
+
+		for ; received < len(endpoints); received++ {
+			voting.addResult(<-results)
+		}
+
+		proxy.evaluateAttestationVoting(voting, majority)
+	}()
+}
+
+// evaluateAttestationVoting logs and counts all endpoints that disagreed with the majority.
+func (proxy *BeaconProxy) evaluateAttestationVoting(voting *attestationVoting, majority *attestationVote) {
+	for _, vote := range voting.votes {
+		agreed := vote.key == majority.key
+
+		if proxy.proxyMetrics != nil {
+			proxy.proxyMetrics.AddAttestationVote(vote.result.endpoint.GetName(), agreed)
+		}
+
+		if agreed {
+			continue
+		}
+
+		proxy.logger.WithFields(logrus.Fields{
+			"endpoint": vote.result.endpoint.GetName(),
+			"majority": majority.key,
+			"votes":    fmt.Sprintf("%d/%d", voting.counts[majority.key], voting.total),
+		}).Warnf("attestation data disagreement: %v", vote.key)
+	}
+
+	for _, result := range voting.failed {
+		proxy.logger.WithField("endpoint", result.endpoint.GetName()).Debugf("attestation data request failed: %v", getFanoutErrorMessage(result))
+	}
+}
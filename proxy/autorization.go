@@ -1,53 +1,149 @@
 package proxy
 
 import (
+	"crypto/x509"
 	"encoding/base64"
+	"fmt"
 	"net/http"
 	"strings"
+
+	"github.com/ethpandaops/dugtrio/types"
+)
+
+const (
+	AuthTypeApiKey = "apikey"
+	AuthTypeBasic  = "basic"
+	AuthTypeJWT    = "jwt"
+	AuthTypeCert   = "cert"
 )
 
-func (proxy *BeaconProxy) CheckAuthorization(r *http.Request) (string, bool) {
+// AuthIdentity is the authenticated identity of a call.
+type AuthIdentity struct {
+	Name string
+	Type string
+	// ApiKey is the matched api key (nil for other auth types)
+	ApiKey *types.ApiKey
+
+	rateTier *types.RateTierConfig
+	acl      *accessControl
+}
+
+// getKey returns the unique key of the identity, identities of different auth types may have the same name.
+func (identity *AuthIdentity) getKey() string {
+	return fmt.Sprintf("%v:%v", identity.Type, identity.Name)
+}
+
+// authProfile holds the limits & restrictions of jwt profiles and client certificates.
+type authProfile struct {
+	config *types.AuthProfile
+	acl    *accessControl
+}
+
+func (proxy *BeaconProxy) compileAuthProfiles(configs []types.AuthProfile) map[string]*authProfile {
+	profiles := make(map[string]*authProfile, len(configs))
+
+	for idx := range configs {
+		profile := &configs[idx]
+		profiles[profile.Name] = &authProfile{
+			config: profile,
+			acl:    proxy.compileAccessControl(&profile.ApiKeyACL),
+		}
+	}
+
+	return profiles
+}
+
+// hasAuthCredentials returns true if the request carries credentials, calls without credentials are no authentication failures.
+func hasAuthCredentials(r *http.Request) bool {
+	return r.Header.Get("X-Dugtrio-Secret-Token") != "" || r.Header.Get("Authorization") != ""
+}
+
+// CheckAuthorization returns the identity of the call (nil for unauthenticated calls) and whether the call is allowed.
+func (proxy *BeaconProxy) CheckAuthorization(r *http.Request) (*AuthIdentity, bool) {
 	requireAuth := proxy.config.Auth != nil && proxy.config.Auth.Required
 
 	// Check for API key in X-Dugtrio-Secret-Token header first
 	apiKey := r.Header.Get("X-Dugtrio-Secret-Token")
 	if apiKey != "" && proxy.config.Auth != nil {
-		for _, key := range proxy.config.Auth.ApiKeys {
+		for idx := range proxy.config.Auth.ApiKeys {
+			key := &proxy.config.Auth.ApiKeys[idx]
 			if key.Key == apiKey {
-				return key.Name, true
+				return &AuthIdentity{
+					Name:     key.Name,
+					Type:     AuthTypeApiKey,
+					ApiKey:   key,
+					rateTier: &key.RateTierConfig,
+					acl:      proxy.apiKeyACLs[key],
+				}, true
 			}
 		}
 		// API key provided but invalid
-		return "", !requireAuth
+		return nil, !requireAuth
 	}
 
 	// Fall back to Basic Auth
 	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		return "", !requireAuth
+	if authHeader == "" && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return proxy.getCertIdentity(r.TLS.VerifiedChains[0][0]), true
+	}
+
+	if authHeader == "" || proxy.config.Auth == nil {
+		return nil, !requireAuth
+	}
+
+	if token, isBearer := strings.CutPrefix(authHeader, "Bearer "); isBearer && proxy.jwt != nil {
+		identity, err := proxy.jwt.validateToken(strings.TrimSpace(token))
+		if err != nil {
+			proxy.logger.Debugf("invalid bearer token: %v", err)
+			return nil, !requireAuth
+		}
+
+		return identity, true
 	}
 
 	// Check the auth type
 	if !strings.HasPrefix(authHeader, "Basic ") {
-		return "", !requireAuth
+		return nil, !requireAuth
 	}
 
 	// decode the header
 	decoded, err := base64.StdEncoding.DecodeString(authHeader[6:])
 	if err != nil {
-		return "", !requireAuth
+		return nil, !requireAuth
 	}
 
 	// split the header into user and password
 	creds := strings.Split(string(decoded), ":")
 	if len(creds) != 2 {
-		return "", !requireAuth
+		return nil, !requireAuth
 	}
 
 	// check the password
 	if proxy.config.Auth.Password == "" || creds[1] != proxy.config.Auth.Password {
-		return "", !requireAuth
+		return nil, !requireAuth
+	}
+
+	return &AuthIdentity{
+		Name: creds[0],
+		Type: AuthTypeBasic,
+	}, true
+}
+
+// getCertIdentity returns the identity of a verified client certificate, the subject common name is used as identity name.
+func (proxy *BeaconProxy) getCertIdentity(cert *x509.Certificate) *AuthIdentity {
+	identity := &AuthIdentity{
+		Name: cert.Subject.CommonName,
+		Type: AuthTypeCert,
+	}
+
+	if identity.Name == "" {
+		identity.Name = cert.Subject.String()
+	}
+
+	if profile := proxy.certProfiles[identity.Name]; profile != nil {
+		identity.rateTier = &profile.config.RateTierConfig
+		identity.acl = profile.acl
 	}
 
-	return creds[0], true
+	return identity
 }
@@ -0,0 +1,265 @@
+package proxy
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ethpandaops/dugtrio/types"
+	"github.com/ethpandaops/dugtrio/utils"
+)
+
+const (
+	BanReasonRateLimit   = "rate-limit"
+	BanReasonAuthFailure = "auth-failure"
+	BanReasonManual      = "manual"
+)
+
+// IPBan is an active ban of a client IP.
+type IPBan struct {
+	IP      string    `json:"ip"`
+	Reason  string    `json:"reason"`
+	Comment string    `json:"comment,omitempty"`
+	Created time.Time `json:"created"`
+	// Expires is the time the ban is lifted (zero = permanent)
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+// banList holds the banned IPs and counts the offenses of IPs that are not banned yet.
+type banList struct {
+	logger *logrus.Entry
+	proxy  *BeaconProxy
+	config *types.BansConfig
+
+	mutex    sync.Mutex
+	bans     map[string]*IPBan
+	offenses map[string]*banOffenses
+}
+
+type banOffenses struct {
+	windowStart   time.Time
+	rateLimitHits int
+	authFailures  int
+}
+
+func (proxy *BeaconProxy) newBanList(config *types.BansConfig) *banList {
+	if config == nil {
+		config = &types.BansConfig{}
+	}
+
+	if config.Window == 0 {
+		config.Window = 1 * time.Minute
+	}
+
+	if config.Duration == 0 {
+		config.Duration = 10 * time.Minute
+	}
+
+	if config.MaxRateLimitHits == 0 && config.MaxAuthFailures == 0 {
+		config.MaxRateLimitHits = 50
+		config.MaxAuthFailures = 10
+	}
+
+	bans := &banList{
+		logger:   logrus.WithField("module", "bans"),
+		proxy:    proxy,
+		config:   config,
+		bans:     map[string]*IPBan{},
+		offenses: map[string]*banOffenses{},
+	}
+
+	go bans.runCleanupLoop()
+
+	return bans
+}
+
+// normalizeBanIP returns the canonical form of the IP, so different notations of the same IP share one ban.
+func normalizeBanIP(ip string) (string, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", fmt.Errorf("invalid ip address '%v'", ip)
+	}
+
+	return addr.Unmap().String(), nil
+}
+
+// getBan returns the active ban of the IP, or nil if the IP is not banned.
+func (bans *banList) getBan(ip string) *IPBan {
+	ip, err := normalizeBanIP(ip)
+	if err != nil {
+		return nil
+	}
+
+	bans.mutex.Lock()
+	defer bans.mutex.Unlock()
+
+	ban := bans.bans[ip]
+	if ban == nil || ban.isExpired(time.Now()) {
+		return nil
+	}
+
+	return ban
+}
+
+// addOffense counts a rate limited call or authentication failure of the IP and bans it when the limit is reached within the window.
+func (bans *banList) addOffense(ip, reason string) {
+	if !bans.config.Enabled {
+		return
+	}
+
+	ip, err := normalizeBanIP(ip)
+	if err != nil {
+		return
+	}
+
+	bans.mutex.Lock()
+	defer bans.mutex.Unlock()
+
+	now := time.Now()
+
+	offenses := bans.offenses[ip]
+	if offenses == nil || now.Sub(offenses.windowStart) > bans.config.Window {
+		offenses = &banOffenses{
+			windowStart: now,
+		}
+		bans.offenses[ip] = offenses
+	}
+
+	limitReached := false
+
+	switch reason {
+	case BanReasonRateLimit:
+		offenses.rateLimitHits++
+		limitReached = bans.config.MaxRateLimitHits > 0 && offenses.rateLimitHits >= bans.config.MaxRateLimitHits
+	case BanReasonAuthFailure:
+		offenses.authFailures++
+		limitReached = bans.config.MaxAuthFailures > 0 && offenses.authFailures >= bans.config.MaxAuthFailures
+	}
+
+	if !limitReached {
+		return
+	}
+
+	delete(bans.offenses, ip)
+
+	bans.bans[ip] = &IPBan{
+		IP:      ip,
+		Reason:  reason,
+		Created: now,
+		Expires: now.Add(bans.config.Duration),
+	}
+
+	bans.logger.Infof("banned %v for %v (reason: %v)", ip, bans.config.Duration, reason)
+
+	if bans.proxy.proxyMetrics != nil {
+		bans.proxy.proxyMetrics.AddIPBan(reason)
+	}
+}
+
+// addBan bans the IP for the given duration (0 = permanent), an existing ban of the IP is replaced.
+func (bans *banList) addBan(ip string, duration time.Duration, comment string) (*IPBan, error) {
+	ip, err := normalizeBanIP(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	ban := &IPBan{
+		IP:      ip,
+		Reason:  BanReasonManual,
+		Comment: comment,
+		Created: now,
+	}
+
+	if duration > 0 {
+		ban.Expires = now.Add(duration)
+	}
+
+	bans.mutex.Lock()
+	bans.bans[ip] = ban
+	delete(bans.offenses, ip)
+	bans.mutex.Unlock()
+
+	bans.logger.Infof("banned %v manually (duration: %v)", ip, duration)
+
+	if bans.proxy.proxyMetrics != nil {
+		bans.proxy.proxyMetrics.AddIPBan(BanReasonManual)
+	}
+
+	return ban, nil
+}
+
+// removeBan lifts the ban of the IP, returns false if the IP was not banned.
+func (bans *banList) removeBan(ip string) bool {
+	ip, err := normalizeBanIP(ip)
+	if err != nil {
+		return false
+	}
+
+	bans.mutex.Lock()
+	defer bans.mutex.Unlock()
+
+	if bans.bans[ip] == nil {
+		return false
+	}
+
+	delete(bans.bans, ip)
+	bans.logger.Infof("removed ban of %v", ip)
+
+	return true
+}
+
+// getBans returns all active bans sorted by creation time.
+func (bans *banList) getBans() []*IPBan {
+	bans.mutex.Lock()
+	defer bans.mutex.Unlock()
+
+	now := time.Now()
+	result := make([]*IPBan, 0, len(bans.bans))
+
+	for _, ban := range bans.bans {
+		if !ban.isExpired(now) {
+			result = append(result, ban)
+		}
+	}
+
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].Created.Before(result[b].Created)
+	})
+
+	return result
+}
+
+func (bans *banList) runCleanupLoop() {
+	defer utils.HandleSubroutinePanic("proxy.bans.cleanup", bans.runCleanupLoop)
+
+	for {
+		time.Sleep(time.Minute)
+
+		now := time.Now()
+
+		bans.mutex.Lock()
+
+		for ip, ban := range bans.bans {
+			if ban.isExpired(now) {
+				delete(bans.bans, ip)
+			}
+		}
+
+		for ip, offenses := range bans.offenses {
+			if now.Sub(offenses.windowStart) > bans.config.Window {
+				delete(bans.offenses, ip)
+			}
+		}
+
+		bans.mutex.Unlock()
+	}
+}
+
+func (ban *IPBan) isExpired(now time.Time) bool {
+	return !ban.Expires.IsZero() && now.After(ban.Expires)
+}
@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type banRequest struct {
+	IP       string `json:"ip"`
+	Duration string `json:"duration"`
+	Comment  string `json:"comment"`
+}
+
+// GetBans returns all active IP bans.
+func (proxy *BeaconProxy) GetBans() []*IPBan {
+	return proxy.bans.getBans()
+}
+
+// IsAutoBanEnabled returns true if IPs are banned automatically for repeated offenses.
+func (proxy *BeaconProxy) IsAutoBanEnabled() bool {
+	return proxy.bans.config.Enabled
+}
+
+// ServeBansHTTP serves the ban list management api, only admin api keys may use it.
+//
+//	GET    /dugtrio/bans          list all active bans
+//	POST   /dugtrio/bans          ban an ip ({"ip": "1.2.3.4", "duration": "1h", "comment": ""}, empty duration = permanent)
+//	DELETE /dugtrio/bans?ip=<ip>  lift the ban of an ip
+func (proxy *BeaconProxy) ServeBansHTTP(w http.ResponseWriter, r *http.Request) {
+	identity, _ := proxy.CheckAuthorization(r)
+	if identity == nil && hasAuthCredentials(r) {
+		proxy.bans.addOffense(proxy.getClientIP(r), BanReasonAuthFailure)
+	}
+
+	if identity == nil {
+		proxy.writeAPIError(w, &apiErrorResponse{
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized",
+		})
+
+		return
+	}
+
+	if identity.ApiKey == nil || !identity.ApiKey.Admin {
+		proxy.writeAPIError(w, &apiErrorResponse{
+			Code:    http.StatusForbidden,
+			Message: "Admin api key required",
+		})
+
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		proxy.writeBansResponse(w, proxy.bans.getBans())
+	case http.MethodPost:
+		request := &banRequest{}
+
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(request)
+		if err != nil {
+			proxy.writeAPIError(w, &apiErrorResponse{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("invalid request body: %v", err),
+			})
+
+			return
+		}
+
+		duration := time.Duration(0)
+		if request.Duration != "" {
+			duration, err = time.ParseDuration(request.Duration)
+			if err != nil || duration < 0 {
+				proxy.writeAPIError(w, &apiErrorResponse{
+					Code:    http.StatusBadRequest,
+					Message: fmt.Sprintf("invalid duration '%v'", request.Duration),
+				})
+
+				return
+			}
+		}
+
+		ban, err := proxy.bans.addBan(request.IP, duration, request.Comment)
+		if err != nil {
+			proxy.writeAPIError(w, &apiErrorResponse{
+				Code:    http.StatusBadRequest,
+				Message: err.Error(),
+			})
+
+			return
+		}
+
+		proxy.logger.Infof("ban of %v added by %v", ban.IP, identity.Name)
+		proxy.writeBansResponse(w, ban)
+	case http.MethodDelete:
+		ip := r.URL.Query().Get("ip")
+		if !proxy.bans.removeBan(ip) {
+			proxy.writeAPIError(w, &apiErrorResponse{
+				Code:    http.StatusNotFound,
+				Message: fmt.Sprintf("no ban found for '%v'", ip),
+			})
+
+			return
+		}
+
+		proxy.logger.Infof("ban of %v removed by %v", ip, identity.Name)
+		proxy.writeBansResponse(w, proxy.bans.getBans())
+	default:
+		proxy.writeAPIError(w, &apiErrorResponse{
+			Code:    http.StatusMethodNotAllowed,
+			Message: "Method not allowed",
+		})
+	}
+}
+
+func (proxy *BeaconProxy) writeBansResponse(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(map[string]any{
+		"data": data,
+	})
+	if err != nil {
+		proxy.logger.Warnf("error writing bans response: %v", err)
+	}
+}
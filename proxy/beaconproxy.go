@@ -1,10 +1,11 @@
 package proxy
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"net/http"
-	"net/url"
+	"net/netip"
 	"regexp"
 	"slices"
 	"sort"
@@ -54,48 +55,88 @@ var passthruResponseHeaderKeys = [...]string{
 }
 
 type BeaconProxy struct {
-	config       *types.ProxyConfig
-	pool         *pool.BeaconPool
-	proxyMetrics *metrics.ProxyMetrics
-	logger       *logrus.Entry
-	blockedPaths []*regexp.Regexp
-
-	sessionMutex sync.Mutex
-	sessions     map[string]*SessionGroup
+	config         *types.ProxyConfig
+	pool           *pool.BeaconPool
+	proxyMetrics   *metrics.ProxyMetrics
+	logger         *logrus.Entry
+	cache          *ResponseCache
+	eventMux       *eventMultiplexer
+	eventReplay    *eventReplayBuffer
+	mergedEvents   *mergedEventStream
+	shadow         *ShadowChecker
+	mirrorSlots    chan struct{}
+	usage          *UsageStore
+	accessRules    *accessRules
+	apiKeyACLs     map[*types.ApiKey]*accessControl
+	jwt            *jwtValidator
+	certProfiles   map[string]*authProfile
+	trustedProxies []netip.Prefix
+	ipFilter       *ipFilter
+	bans           *banList
+	callCosts      []*callCost
+	hedgePaths     []*regexp.Regexp
+	broadcastPaths []*regexp.Regexp
+
+	coalescePaths  []*regexp.Regexp
+	coalesceMutex  sync.Mutex
+	coalescedCalls map[string]*coalescedCall
+
+	hedgeMutex   sync.Mutex
+	hedgeLatency map[int]*latencyTracker
+
+	rateTierMutex sync.Mutex
+	rateTiers     map[string]*rateTier
+	quotas        *quotaStore
+
+	sessionMutex  sync.Mutex
+	sessions      map[string]*SessionGroup
+	sessionLimits map[string]*sessionLimits
+	sessionKeys   *sessionKeys
+	subnetLimits  *subnetLimits
 }
 
 func NewBeaconProxy(config *types.ProxyConfig, beaconPool *pool.BeaconPool, proxyMetrics *metrics.ProxyMetrics) (*BeaconProxy, error) {
 	proxy := BeaconProxy{
-		config:       config,
-		pool:         beaconPool,
-		proxyMetrics: proxyMetrics,
-		logger:       logrus.WithField("module", "proxy"),
-		blockedPaths: []*regexp.Regexp{},
-		sessions:     make(map[string]*SessionGroup),
+		config:        config,
+		pool:          beaconPool,
+		proxyMetrics:  proxyMetrics,
+		logger:        logrus.WithField("module", "proxy"),
+		sessions:      make(map[string]*SessionGroup),
+		sessionLimits: make(map[string]*sessionLimits),
+		hedgeLatency:  make(map[int]*latencyTracker),
+		rateTiers:     make(map[string]*rateTier),
+
+		coalescedCalls: make(map[string]*coalescedCall),
 	}
 
-	blockedPaths := []string{}
-	blockedPaths = append(blockedPaths, config.BlockedPaths...)
+	proxy.accessRules = proxy.compileAccessRules(config)
+	proxy.trustedProxies = proxy.parseIPPrefixes(utils.SplitConfigList(config.TrustedProxies, config.TrustedProxiesStr))
+	if err := proxy.checkForwardedHeader(); err != nil {
+		return nil, err
+	}
 
-	for _, blockedPath := range strings.Split(config.BlockedPathsStr, ",") {
-		blockedPath = strings.Trim(blockedPath, " ")
-		if blockedPath == "" {
-			continue
-		}
+	proxy.ipFilter = proxy.compileIPFilter(config.IPFilter)
+	proxy.bans = proxy.newBanList(config.Bans)
+	proxy.subnetLimits = proxy.newSubnetLimits(config.SubnetLimits)
 
-		blockedPaths = append(blockedPaths, blockedPath)
+	sessionKeys, err := proxy.newSessionKeys(config.SessionKeys)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, blockedPath := range blockedPaths {
-		blockedPathPattern, err := regexp.Compile(blockedPath)
-		if err != nil {
-			proxy.logger.Errorf("error parsing blocked path pattern '%v': %v", blockedPath, err)
-			continue
-		}
+	proxy.sessionKeys = sessionKeys
 
-		proxy.blockedPaths = append(proxy.blockedPaths, blockedPathPattern)
+	proxy.apiKeyACLs = proxy.compileApiKeyACLs()
+	proxy.callCosts = proxy.compileCallCosts(config.CallCosts)
+	proxy.hedgePaths = proxy.compilePathPatterns(config.HedgePaths, config.HedgePathsStr)
+	proxy.coalescePaths = proxy.compilePathPatterns(config.CoalescePaths, config.CoalescePathsStr)
+
+	if config.BroadcastPaths == nil && config.BroadcastPathsStr == "" {
+		config.BroadcastPaths = defaultBroadcastPaths
 	}
 
+	proxy.broadcastPaths = proxy.compilePathPatterns(config.BroadcastPaths, config.BroadcastPathsStr)
+
 	if config.CallTimeout == 0 {
 		config.CallTimeout = 60 * time.Second
 	}
@@ -104,6 +145,86 @@ func NewBeaconProxy(config *types.ProxyConfig, beaconPool *pool.BeaconPool, prox
 		config.SessionTimeout = 10 * time.Minute
 	}
 
+	if config.MaxRequestBodySize == 0 {
+		config.MaxRequestBodySize = 32 * 1024 * 1024
+	}
+
+	if config.HedgeDelay == 0 {
+		config.HedgeDelay = 1 * time.Second
+	}
+
+	if config.MirrorSampleRate == nil {
+		mirrorSampleRate := 0.1
+		config.MirrorSampleRate = &mirrorSampleRate
+	}
+
+	if config.MirrorMaxConcurrent == 0 {
+		config.MirrorMaxConcurrent = 64
+	}
+
+	proxy.mirrorSlots = make(chan struct{}, config.MirrorMaxConcurrent)
+
+	quotaFile := ""
+	if config.Auth != nil {
+		quotaFile = config.Auth.QuotaFile
+	}
+
+	proxy.quotas = newQuotaStore(quotaFile)
+
+	if config.Auth != nil {
+		proxy.jwt = proxy.newJWTValidator(config.Auth.JWT)
+		proxy.certProfiles = proxy.compileAuthProfiles(config.Auth.ClientCerts)
+	}
+
+	if config.BestValueBlocks != nil {
+		if config.BestValueBlocks.Deadline == 0 {
+			config.BestValueBlocks.Deadline = 2 * time.Second
+		}
+	}
+
+	if config.AttestationConsensus != nil {
+		if config.AttestationConsensus.Endpoints == 0 {
+			config.AttestationConsensus.Endpoints = 3
+		}
+
+		if config.AttestationConsensus.Deadline == 0 {
+			config.AttestationConsensus.Deadline = 1 * time.Second
+		}
+	}
+
+	if config.Shadow != nil && config.Shadow.Enabled {
+		proxy.shadow = newShadowChecker(&proxy, config.Shadow, proxyMetrics)
+	}
+
+	if config.Usage != nil && config.Usage.Enabled {
+		if config.Usage.DBPath == "" {
+			config.Usage.DBPath = "dugtrio-usage.db"
+		}
+
+		usage, err := newUsageStore(config.Usage)
+		if err != nil {
+			return nil, err
+		}
+
+		proxy.usage = usage
+	}
+
+	if config.Cache != nil && config.Cache.Enabled {
+		proxy.cache = newResponseCache(config.Cache, beaconPool.GetBlockCache(), proxyMetrics)
+	}
+
+	if config.EventMux != nil && config.EventMux.Enabled {
+		proxy.eventMux = newEventMultiplexer(&proxy, config.EventMux)
+	}
+
+	if config.EventReplaySize > 0 {
+		proxy.eventReplay = newEventReplayBuffer(config.EventReplaySize)
+	}
+
+	if config.MergedEvents {
+		proxy.mergedEvents = newMergedEventStream(&proxy)
+	}
+
 	if config.RebalanceInterval > 0 {
 		go proxy.rebalanceSessionsLoop()
 	}
@@ -113,6 +234,50 @@ func NewBeaconProxy(config *types.ProxyConfig, beaconPool *pool.BeaconPool, prox
 	return &proxy, nil
 }
 
+// Shutdown persists the quota and usage counters that have not been written by the background loops yet.
+func (proxy *BeaconProxy) Shutdown() {
+	proxy.quotas.shutdown()
+
+	if proxy.usage != nil {
+		if err := proxy.usage.flush(); err != nil {
+			proxy.logger.Warnf("error flushing usage counters: %v", err)
+		}
+	}
+}
+
+// GetShadowChecker returns the consistency checker (nil if disabled).
+func (proxy *BeaconProxy) GetShadowChecker() *ShadowChecker {
+	return proxy.shadow
+}
+
+func (proxy *BeaconProxy) compilePathPatterns(patterns []string, patternsStr string) []*regexp.Regexp {
+	allPatterns := []string{}
+	allPatterns = append(allPatterns, patterns...)
+
+	for _, pattern := range strings.Split(patternsStr, ",") {
+		pattern = strings.Trim(pattern, " ")
+		if pattern == "" {
+			continue
+		}
+
+		allPatterns = append(allPatterns, pattern)
+	}
+
+	compiledPatterns := make([]*regexp.Regexp, 0, len(allPatterns))
+
+	for _, pattern := range allPatterns {
+		compiledPattern, err := regexp.Compile(pattern)
+		if err != nil {
+			proxy.logger.Errorf("error parsing path pattern '%v': %v", pattern, err)
+			continue
+		}
+
+		compiledPatterns = append(compiledPatterns, compiledPattern)
+	}
+
+	return compiledPatterns
+}
+
 func (proxy *BeaconProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	proxy.processCall(w, r, pool.UnspecifiedClient, pool.UnspecifiedClient)
 }
@@ -139,19 +304,37 @@ func (proxy *BeaconProxy) ServeHealthCheckHTTP(w http.ResponseWriter, _ *http.Re
 }
 
 func (proxy *BeaconProxy) processCall(w http.ResponseWriter, r *http.Request, clientType, sessionPrefix pool.ClientType) {
-	if proxy.checkBlockedPaths(r.URL) {
-		w.Header().Set("Content-Type", "text/html")
-		w.WriteHeader(http.StatusForbidden)
+	clientIP := proxy.getClientIP(r)
 
-		_, err := w.Write([]byte("Path Blocked"))
-		if err != nil {
-			proxy.logger.Warnf("error writing path blocked response: %v", err)
-		}
+	var identity *AuthIdentity
+
+	if proxy.usage != nil {
+		// account the call after it has been processed, including calls rejected by the ip, auth & access checks
+		usageWriter := newProxyResponseWriter(w, 0)
+		w = usageWriter
 
+		start := time.Now()
+
+		defer func() {
+			latency := time.Duration(0)
+			if !usageWriter.headerTime.IsZero() {
+				latency = usageWriter.headerTime.Sub(start)
+			}
+
+			proxy.usage.record(getUsageIdentity(identity, clientIP), getUsagePathClass(r.URL.Path), usageWriter.status, usageWriter.written, latency)
+		}()
+	}
+
+	if errorResponse := proxy.checkClientIP(clientIP); errorResponse != nil {
+		proxy.writeAPIError(w, errorResponse)
 		return
 	}
 
-	identifier, validAuth := proxy.CheckAuthorization(r)
+	identity, validAuth := proxy.CheckAuthorization(r)
+	if identity == nil && hasAuthCredentials(r) {
+		proxy.bans.addOffense(clientIP, BanReasonAuthFailure)
+	}
+
 	if !validAuth {
 		w.Header().Set("Content-Type", "text/html")
 		w.WriteHeader(http.StatusUnauthorized)
@@ -164,21 +347,145 @@ func (proxy *BeaconProxy) processCall(w http.ResponseWriter, r *http.Request, cl
 		return
 	}
 
-	session := proxy.getSessionForRequest(r, identifier, sessionPrefix)
-	if session.group.checkCallLimit(1) != nil {
-		w.Header().Set("Content-Type", "text/html")
-		w.WriteHeader(http.StatusTooManyRequests)
+	if errorResponse := proxy.checkAccessRules(r, identity, sessionPrefix); errorResponse != nil {
+		proxy.writeAPIError(w, errorResponse)
+		return
+	}
 
-		_, err := w.Write([]byte("Call Limit exceeded"))
-		if err != nil {
-			proxy.logger.Warnf("error writing call limit exceeded response: %v", err)
+	if identity != nil && identity.acl != nil {
+		if errorResponse := identity.acl.checkCall(r, sessionPrefix); errorResponse != nil {
+			proxy.writeAPIError(w, errorResponse)
+			return
 		}
+	}
 
+	session, limits := proxy.getSessionForRequest(w, r, identity, sessionPrefix)
+
+	callCost := proxy.getCallCost(r)
+	if limits.checkCallLimit(callCost) != nil {
+		proxy.bans.addOffense(clientIP, BanReasonRateLimit)
+		limits.setRateLimitHeaders(w.Header(), callCost, true)
+		proxy.writeAPIError(w, &apiErrorResponse{
+			Code:    http.StatusTooManyRequests,
+			Message: "Call Limit exceeded",
+		})
+
+		return
+	}
+
+	limits.setRateLimitHeaders(w.Header(), callCost, false)
+	w.Header().Set("X-Dugtrio-Session-Tokens", fmt.Sprintf("%.2f", limits.getCallLimitTokens()))
+
+	releaseTier, ok := proxy.checkTierLimits(w, limits)
+	if !ok {
 		return
 	}
 
+	defer releaseTier()
+
+	if proxy.config.CallCostPerMiB > 0 {
+		costWriter := proxy.newResponseCostWriter(w, limits)
+		w = costWriter
+
+		defer costWriter.chargeWrittenSize()
+	}
+
+	proxy.startMirrorCalls(r)
+
+	if proxy.isAttestationConsensusCall(r) {
+		session.group.requests.Add(1)
+		proxy.processAttestationConsensusCall(w, r, session, clientType)
+
+		return
+	}
+
+	if proxy.isBestValueBlockCall(r) {
+		session.group.requests.Add(1)
+		proxy.processBestValueBlockCall(w, r, session, clientType)
+
+		return
+	}
+
+	if proxy.isBroadcastCall(r) {
+		session.group.requests.Add(1)
+		proxy.processBroadcastCall(w, r, session, clientType)
+
+		return
+	}
+
+	if proxy.mergedEvents != nil && isMergedEventStreamRequest(r) {
+		if session.group.isEndpointRestricted() {
+			// the merged stream combines the events of all endpoints
+			proxy.writeAPIError(w, &apiErrorResponse{
+				Code:    http.StatusForbidden,
+				Message: "Merged event stream not allowed for this identity",
+			})
+
+			return
+		}
+
+		session.group.requests.Add(1)
+		proxy.mergedEvents.serve(w, r, session)
+
+		return
+	}
+
+	// streams with unknown topics are not multiplexed, the upstream decides about them
+	if proxy.eventMux != nil && isEventStreamRequest(r) && !hasNextEndpointOverride(r) && !session.group.isEndpointRestricted() &&
+		hasOnlyKnownEventTopics(getEventStreamTopics(r)) {
+		session.group.requests.Add(1)
+		proxy.eventMux.serve(w, r, session, clientType)
+
+		return
+	}
+
+	// sessions restricted to some endpoints must not get responses of other endpoints from the cache
+	cacheKey := ""
+	if proxy.cache != nil && !session.group.isEndpointRestricted() {
+		cacheKey = proxy.cache.getCacheKey(r, clientType)
+	}
+
+	if cacheKey != "" && proxy.cache.serveCachedResponse(w, r, cacheKey, session) {
+		session.group.requests.Add(1)
+		return
+	}
+
+	var leaderCall *coalescedCall
+
+	if coalesceKey := proxy.getCoalesceKey(r, clientType); coalesceKey != "" && !session.group.isEndpointRestricted() {
+		call, isLeader := proxy.joinCoalescedCall(coalesceKey)
+		if isLeader {
+			leaderCall = call
+			defer proxy.finishCoalescedCall(coalesceKey, call)
+
+			w = &coalescingResponseWriter{
+				ResponseWriter: w,
+				call:           call,
+			}
+		} else if served, err := call.serve(w, session); served {
+			session.group.requests.Add(1)
+
+			if proxy.proxyMetrics != nil {
+				proxy.proxyMetrics.AddCoalescedCall(fmt.Sprintf("%s%s", r.Method, r.URL.EscapedPath()))
+			}
+
+			if err != nil {
+				proxy.logger.Debugf("error writing coalesced response: %v", err)
+			}
+
+			return
+		}
+	}
+
 	endpoint, err := proxy.getEndpointForCall(r, session, clientType)
-	if err != nil {
+	if errors.Is(err, errEndpointNotAllowed) {
+		proxy.writeAPIError(w, &apiErrorResponse{
+			Code:    http.StatusForbidden,
+			Message: err.Error(),
+		})
+
+		return
+	} else if err != nil {
 		w.Header().Set("Content-Type", "text/html")
 		w.WriteHeader(http.StatusServiceUnavailable)
 
@@ -204,7 +511,50 @@ func (proxy *BeaconProxy) processCall(w http.ResponseWriter, r *http.Request, cl
 
 	session.group.requests.Add(1)
 
+	var cacheWriter *cacheResponseWriter
+
+	if cacheKey != "" {
+		cacheWriter = proxy.cache.newResponseWriter(w)
+		cacheWriter.Header().Set("X-Dugtrio-Cache", "miss")
+
+		defer cacheWriter.discard()
+
+		w = cacheWriter
+	}
+
+	var shadowWriter *proxyResponseWriter
+
+	shadowPattern := ""
+	if proxy.shadow != nil {
+		shadowPattern = proxy.shadow.getSamplePattern(r)
+	}
+
+	if shadowPattern != "" {
+		shadowWriter = newProxyResponseWriter(w, proxy.shadow.getCaptureLimit())
+		w = shadowWriter
+	}
+
 	err = proxy.processProxyCall(w, r, session, endpoint)
+	if err != nil && leaderCall != nil {
+		leaderCall.abort()
+	}
+
+	if err == nil && cacheWriter != nil && cacheWriter.status == http.StatusOK {
+		proxy.cache.storeResponse(cacheKey, cacheWriter)
+	}
+
+	if err == nil && shadowWriter != nil {
+		if body, ok := shadowWriter.getCapturedBody(); ok {
+			// hedged calls might have been answered by another endpoint
+			primary := proxy.pool.GetEndpointByName(shadowWriter.Header().Get("X-Dugtrio-Endpoint-Name"))
+			if primary == nil {
+				primary = endpoint
+			}
+
+			proxy.shadow.startCheck(r, shadowPattern, primary, shadowWriter.status, shadowWriter.Header(), body)
+		}
+	}
+
 	if err != nil {
 		w.Header().Set("Content-Type", "text/html")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -222,40 +572,30 @@ func (proxy *BeaconProxy) processCall(w http.ResponseWriter, r *http.Request, cl
 	}
 }
 
-func (proxy *BeaconProxy) checkBlockedPaths(reqURL *url.URL) bool {
-	for _, blockedPathPattern := range proxy.blockedPaths {
-		match := blockedPathPattern.MatchString(reqURL.EscapedPath())
-		if match {
-			return true
-		}
-	}
-
-	return false
-}
-
 func (proxy *BeaconProxy) getEndpointForCall(r *http.Request, session *Session, clientType pool.ClientType) (*pool.Client, error) {
 	var endpoint *pool.Client
-	if proxy.config.StickyEndpoint && proxy.pool.IsClientReady(session.lastPoolClient) {
+	if proxy.config.StickyEndpoint && proxy.pool.IsClientReady(session.lastPoolClient) && session.group.isEndpointAllowed(session.lastPoolClient) {
 		endpoint = session.lastPoolClient
 	}
 
-	minCgc := uint16(0)
-	if strings.HasPrefix(r.URL.Path, "/eth/v1/beacon/blobs/") {
-		minCgc = 64 // 64 is the minimum CGC for blobs
-	}
-
-	nextEndpoint := r.Header.Get("X-Dugtrio-Next-Endpoint")
-	if nextEndpoint == "" {
-		nextEndpoint = r.URL.Query().Get("dugtrio-next-endpoint")
-	}
+	minCgc := getMinCgcForCall(r)
 
+	nextEndpoint := getNextEndpointOverride(r)
 	if nextEndpoint != "" {
 		endpoint = nil
 
 		nextEndpointType := pool.ParseClientType(nextEndpoint)
 		if nextEndpointType != pool.UnknownClient {
+			if session.group.acl != nil && !session.group.acl.isClientTypeAllowed(nextEndpointType) {
+				return nil, fmt.Errorf("%w: %v", errEndpointNotAllowed, nextEndpoint)
+			}
+
 			clientType = nextEndpointType
-		} else if client := proxy.pool.GetEndpointByName(nextEndpoint); client != nil {
+		} else if client := proxy.pool.GetEndpointByName(nextEndpoint); client != nil && !client.IsMirror() {
+			if !session.group.isEndpointAllowed(client) {
+				return nil, fmt.Errorf("%w: %v", errEndpointNotAllowed, nextEndpoint)
+			}
+
 			if client.GetCustodyGroupCount() < minCgc {
 				return nil, fmt.Errorf("endpoint %s has too low CGC (%d < %d)", nextEndpoint, client.GetCustodyGroupCount(), minCgc)
 			}
@@ -274,7 +614,11 @@ func (proxy *BeaconProxy) getEndpointForCall(r *http.Request, session *Session,
 	}
 
 	if endpoint == nil || (clientType != pool.UnspecifiedClient && endpoint.GetClientType() != clientType) {
-		endpoint = proxy.pool.GetReadyEndpoint(clientType, minCgc)
+		if session.group.isEndpointRestricted() {
+			endpoint = proxy.pool.GetReadyEndpointWithFilter(clientType, minCgc, session.group.isEndpointAllowed)
+		} else {
+			endpoint = proxy.pool.GetReadyEndpoint(clientType, minCgc)
+		}
 
 		if minCgc == 0 {
 			session.setLastPoolClient(endpoint)
@@ -284,6 +628,27 @@ func (proxy *BeaconProxy) getEndpointForCall(r *http.Request, session *Session,
 	return endpoint, nil
 }
 
+func getNextEndpointOverride(r *http.Request) string {
+	nextEndpoint := r.Header.Get("X-Dugtrio-Next-Endpoint")
+	if nextEndpoint == "" {
+		nextEndpoint = r.URL.Query().Get("dugtrio-next-endpoint")
+	}
+
+	return nextEndpoint
+}
+
+func hasNextEndpointOverride(r *http.Request) bool {
+	return getNextEndpointOverride(r) != ""
+}
+
+func getMinCgcForCall(r *http.Request) uint16 {
+	if strings.HasPrefix(r.URL.Path, "/eth/v1/beacon/blobs/") {
+		return 64 // 64 is the minimum CGC for blobs
+	}
+
+	return 0
+}
+
 func (proxy *BeaconProxy) rebalanceSessionsLoop() {
 	defer utils.HandleSubroutinePanic("proxy.session.rebalance", proxy.rebalanceSessionsLoop)
 
@@ -401,6 +766,11 @@ func (proxy *BeaconProxy) rebalanceSessions() {
 					continue
 				}
 
+				if session.group.isEndpointRestricted() {
+					// restricted sessions might not be allowed to use the target endpoint
+					continue
+				}
+
 				if session.prefix == pool.UnspecifiedClient {
 					unconstrained = append(unconstrained, session)
 				} else {
@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ethpandaops/dugtrio/pool"
+)
+
+var produceBlockV3Pattern = regexp.MustCompile(`^/eth/v3/validator/blocks/([0-9]+)$`)
+
+// blockProposal is a block proposal returned by one of the endpoints.
+type blockProposal struct {
+	result         *fanoutResult
+	consensusValue *big.Int
+	executionValue *big.Int
+	totalValue     *big.Int
+}
+
+func (proxy *BeaconProxy) isBestValueBlockCall(r *http.Request) bool {
+	if proxy.config.BestValueBlocks == nil || !proxy.config.BestValueBlocks.Enabled {
+		return false
+	}
+
+	if r.Method != http.MethodGet || hasNextEndpointOverride(r) {
+		return false
+	}
+
+	return produceBlockV3Pattern.MatchString(r.URL.EscapedPath())
+}
+
+// parseBlockValue parses a block value header (wei as decimal string). Missing or invalid values count as 0.
+func parseBlockValue(header http.Header, key string) *big.Int {
+	value, ok := new(big.Int).SetString(strings.TrimSpace(header.Get(key)), 10)
+	if !ok {
+		return new(big.Int)
+	}
+
+	return value
+}
+
+// processBestValueBlockCall requests a block proposal from multiple endpoints in parallel and returns the proposal
+// with the highest consensus + execution payload value. Endpoints that fail or miss the deadline are ignored.
+// If no endpoint returned a proposal within the deadline, the first proposal that arrives within the call timeout is returned.
+func (proxy *BeaconProxy) processBestValueBlockCall(w http.ResponseWriter, r *http.Request, session *Session, clientType pool.ClientType) {
+	config := proxy.config.BestValueBlocks
+
+	endpoints := proxy.getFanoutEndpoints(session, clientType, config.MaxEndpoints)
+	if len(endpoints) == 0 {
+		proxy.writeAPIError(w, &apiErrorResponse{
+			Code:    http.StatusServiceUnavailable,
+			Message: "No Endpoint available",
+		})
+
+		return
+	}
+
+	slot := produceBlockV3Pattern.FindStringSubmatch(r.URL.EscapedPath())[1]
+
+	ctx, cancel := context.WithTimeout(r.Context(), proxy.config.CallTimeout)
+	defer cancel()
+
+	deadlineTimer := time.NewTimer(config.Deadline)
+	defer deadlineTimer.Stop()
+
+	results := proxy.fanoutCall(ctx, r, nil, endpoints)
+	failed := make([]*fanoutResult, 0, len(endpoints))
+	deadlinePassed := false
+	bids := 0
+
+	var best *blockProposal
+
+	for pending := len(endpoints); pending > 0 && (!deadlinePassed || best == nil); {
+		var result *fanoutResult
+
+		select {
+		case <-deadlineTimer.C:
+			deadlinePassed = true
+			continue
+		case result = <-results:
+			pending--
+		}
+
+		if !result.isSuccess() {
+			proxy.logger.WithField("endpoint", result.endpoint.GetName()).Debugf("block proposal for slot %v failed: %v", slot, getFanoutErrorMessage(result))
+
+			failed = append(failed, result)
+
+			continue
+		}
+
+		proposal := &blockProposal{
+			result:         result,
+			consensusValue: parseBlockValue(result.header, "Eth-Consensus-Block-Value"),
+			executionValue: parseBlockValue(result.header, "Eth-Execution-Payload-Value"),
+		}
+		proposal.totalValue = new(big.Int).Add(proposal.consensusValue, proposal.executionValue)
+		bids++
+
+		proxy.logger.WithFields(logrus.Fields{
+			"endpoint":        result.endpoint.GetName(),
+			"slot":            slot,
+			"consensus_value": proposal.consensusValue.String(),
+			"execution_value": proposal.executionValue.String(),
+			"blinded":         result.header.Get("Eth-Execution-Payload-Blinded"),
+			"duration":        result.duration.Milliseconds(),
+		}).Infof("block proposal bid for slot %v: %v wei", slot, proposal.totalValue.String())
+
+		// on equal value, the earlier proposal wins
+		if best == nil || proposal.totalValue.Cmp(best.totalValue) > 0 {
+			best = proposal
+		}
+	}
+
+	if best == nil {
+		proxy.writeAPIError(w, getFanoutError("block production", failed))
+		return
+	}
+
+	proxy.logger.Infof("selected block proposal for slot %v from %v (%v wei, %v/%v bids)", slot, best.result.endpoint.GetName(), best.totalValue.String(), bids, len(endpoints))
+
+	if proxy.proxyMetrics != nil {
+		proxy.proxyMetrics.AddBestValueBlock(best.result.endpoint.GetName())
+	}
+
+	w.Header().Set("X-Dugtrio-Block-Bids", fmt.Sprintf("%d", bids))
+
+	err := proxy.writeFanoutResult(w, session, best.result)
+	if err != nil {
+		proxy.logger.Debugf("error writing block proposal response: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/ethpandaops/dugtrio/pool"
+	"github.com/ethpandaops/dugtrio/utils"
+)
+
+// defaultBroadcastPaths are the publishing endpoints that are sent to all ready endpoints by default.
+var defaultBroadcastPaths = []string{
+	"^/eth/v[0-9]+/beacon/blocks$",
+	"^/eth/v[0-9]+/beacon/pool/",
+	"^/eth/v[0-9]+/validator/prepare_beacon_proposer$",
+}
+
+func (proxy *BeaconProxy) isBroadcastCall(r *http.Request) bool {
+	if r.Method != http.MethodPost || hasNextEndpointOverride(r) {
+		return false
+	}
+
+	for _, broadcastPathPattern := range proxy.broadcastPaths {
+		if broadcastPathPattern.MatchString(r.URL.EscapedPath()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// processBroadcastCall sends the call to all ready endpoints in parallel and returns the first successful response.
+// If all endpoints fail, an aggregated error is returned.
+func (proxy *BeaconProxy) processBroadcastCall(w http.ResponseWriter, r *http.Request, session *Session, clientType pool.ClientType) {
+	endpoints := session.group.filterEndpoints(proxy.pool.GetReadyEndpoints(clientType, 0))
+	if len(endpoints) == 0 {
+		proxy.writeAPIError(w, &apiErrorResponse{
+			Code:    http.StatusServiceUnavailable,
+			Message: "No Endpoint available",
+		})
+
+		return
+	}
+
+	body, apiErr := proxy.readRequestBody(w, r)
+	if apiErr != nil {
+		proxy.writeAPIError(w, apiErr)
+		return
+	}
+
+	callPath := fmt.Sprintf("%s%s", r.Method, r.URL.EscapedPath())
+
+	// keep publishing to all endpoints when the client disconnects early
+	results := proxy.fanoutCall(context.WithoutCancel(r.Context()), r, body, endpoints)
+	failed := make([]*fanoutResult, 0, len(endpoints))
+
+	for i := range endpoints {
+		result := <-results
+		if !result.isSuccess() {
+			failed = append(failed, result)
+			continue
+		}
+
+		w.Header().Set("X-Dugtrio-Broadcast", fmt.Sprintf("%d", len(endpoints)))
+
+		err := proxy.writeFanoutResult(w, session, result)
+		if err != nil {
+			proxy.logger.Debugf("error writing broadcast response: %v", err)
+		}
+
+		go proxy.finishBroadcastCall(callPath, results, len(endpoints)-i-1, failed)
+
+		return
+	}
+
+	proxy.logBroadcastFailures(callPath, failed)
+
+	if proxy.proxyMetrics != nil {
+		proxy.proxyMetrics.AddBroadcastCall(callPath, "failed")
+	}
+
+	proxy.writeAPIError(w, getFanoutError("broadcast", failed))
+}
+
+// finishBroadcastCall waits for the remaining endpoints of a successful broadcast call.
+func (proxy *BeaconProxy) finishBroadcastCall(callPath string, results <-chan *fanoutResult, remaining int, failed []*fanoutResult) {
+	defer utils.HandleSubroutinePanic("proxy.broadcast.finish", nil)
+
+	for i := 0; i < remaining; i++ {
+		result := <-results
+		if !result.isSuccess() {
+			failed = append(failed, result)
+		}
+	}
+
+	proxy.logBroadcastFailures(callPath, failed)
+
+	if proxy.proxyMetrics != nil {
+		result := "success"
+		if len(failed) > 0 {
+			result = "partial"
+		}
+
+		proxy.proxyMetrics.AddBroadcastCall(callPath, result)
+	}
+}
+
+func (proxy *BeaconProxy) logBroadcastFailures(callPath string, failed []*fanoutResult) {
+	for _, result := range failed {
+		proxy.logger.WithField("endpoint", result.endpoint.GetName()).Debugf("broadcast %v failed: %v", callPath, getFanoutErrorMessage(result))
+	}
+}
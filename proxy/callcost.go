@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ethpandaops/dugtrio/types"
+)
+
+// responseCostWriter charges the response size cost of a call. Responses with a Content-Length header are charged
+// when the headers are written, before the body is streamed. Other responses are charged after the call.
+type responseCostWriter struct {
+	*proxyResponseWriter
+	proxy   *BeaconProxy
+	limits  *sessionLimits
+	charged bool
+}
+
+func (proxy *BeaconProxy) newResponseCostWriter(w http.ResponseWriter, limits *sessionLimits) *responseCostWriter {
+	return &responseCostWriter{
+		proxyResponseWriter: newProxyResponseWriter(w, 0),
+		proxy:               proxy,
+		limits:              limits,
+	}
+}
+
+func (rw *responseCostWriter) WriteHeader(statusCode int) {
+	if rw.status == 0 {
+		rw.chargeContentLength()
+	}
+
+	rw.proxyResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *responseCostWriter) Write(data []byte) (int, error) {
+	if rw.status == 0 {
+		rw.chargeContentLength()
+	}
+
+	return rw.proxyResponseWriter.Write(data)
+}
+
+func (rw *responseCostWriter) chargeContentLength() {
+	contentLength, err := strconv.ParseInt(rw.Header().Get("Content-Length"), 10, 64)
+	if err != nil || contentLength <= 0 {
+		return
+	}
+
+	rw.limits.addCallCost(rw.proxy.getResponseSizeCost(contentLength))
+	rw.charged = true
+}
+
+// chargeWrittenSize charges the size of responses without Content-Length after the call.
+func (rw *responseCostWriter) chargeWrittenSize() {
+	if !rw.charged {
+		rw.limits.addCallCost(rw.proxy.getResponseSizeCost(rw.written))
+	}
+}
+
+// callCost is a compiled entry of the call cost table.
+type callCost struct {
+	pattern *regexp.Regexp
+	method  string
+	cost    int
+}
+
+func (proxy *BeaconProxy) compileCallCosts(costConfigs []*types.CallCostConfig) []*callCost {
+	callCosts := make([]*callCost, 0, len(costConfigs))
+
+	for _, costConfig := range costConfigs {
+		pattern, err := regexp.Compile(costConfig.Path)
+		if err != nil {
+			proxy.logger.Errorf("error parsing call cost path pattern '%v': %v", costConfig.Path, err)
+			continue
+		}
+
+		callCosts = append(callCosts, &callCost{
+			pattern: pattern,
+			method:  strings.ToUpper(costConfig.Method),
+			cost:    costConfig.Cost,
+		})
+	}
+
+	return callCosts
+}
+
+// getCallCost returns the rate limit cost of the call from the first matching cost table entry (default 1).
+func (proxy *BeaconProxy) getCallCost(r *http.Request) int {
+	for _, cost := range proxy.callCosts {
+		if cost.method != "" && cost.method != r.Method {
+			continue
+		}
+
+		if cost.pattern.MatchString(r.URL.EscapedPath()) {
+			return cost.cost
+		}
+	}
+
+	return 1
+}
+
+// getResponseSizeCost returns the additional rate limit cost for the response size.
+func (proxy *BeaconProxy) getResponseSizeCost(responseSize int64) int {
+	if proxy.config.CallCostPerMiB <= 0 || responseSize <= 0 {
+		return 0
+	}
+
+	return int(math.Ceil(float64(responseSize) / (1024 * 1024) * proxy.config.CallCostPerMiB))
+}
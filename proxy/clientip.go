@@ -0,0 +1,227 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const (
+	forwardedHeaderForwardedFor = "X-Forwarded-For"
+	forwardedHeaderForwarded    = "Forwarded"
+	forwardedHeaderRealIP       = "X-Real-IP"
+)
+
+// checkForwardedHeader normalizes the configured forwarded header of the trusted proxies.
+func (proxy *BeaconProxy) checkForwardedHeader() error {
+	switch header := proxy.config.ForwardedHeader; {
+	case header == "", strings.EqualFold(header, forwardedHeaderForwardedFor):
+		proxy.config.ForwardedHeader = forwardedHeaderForwardedFor
+	case strings.EqualFold(header, forwardedHeaderForwarded):
+		proxy.config.ForwardedHeader = forwardedHeaderForwarded
+	case strings.EqualFold(header, forwardedHeaderRealIP):
+		proxy.config.ForwardedHeader = forwardedHeaderRealIP
+	default:
+		return fmt.Errorf("invalid forwarded header '%v' (X-Forwarded-For, Forwarded or X-Real-IP)", proxy.config.ForwardedHeader)
+	}
+
+	return nil
+}
+
+// getClientIP returns the IP of the client that sent the request (empty if it cannot be determined).
+// With trusted proxies, the configured forwarding header is walked from the right and the first hop that is
+// not a trusted proxy is used. Without trusted proxies, the legacy ProxyCount is applied to X-Forwarded-For.
+func (proxy *BeaconProxy) getClientIP(r *http.Request) string {
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+
+	if len(proxy.trustedProxies) > 0 {
+		return proxy.resolveForwardedIP(r, remoteIP)
+	}
+
+	if proxy.config.ProxyCount > 0 {
+		forwardIps := getForwardedForChain(r)
+
+		forwardIdx := len(forwardIps) - proxy.config.ProxyCount
+		if forwardIdx >= 0 && forwardIdx < len(forwardIps) {
+			if ip := forwardIps[forwardIdx]; ip != "" {
+				return ip
+			}
+		}
+	}
+
+	return remoteIP
+}
+
+func (proxy *BeaconProxy) resolveForwardedIP(r *http.Request, remoteIP string) string {
+	if !proxy.isTrustedProxy(remoteIP) {
+		return remoteIP
+	}
+
+	// only the header written by the trusted proxies is read, other forwarding headers are passed through unchecked by most proxies
+	var chain []string
+
+	switch proxy.config.ForwardedHeader {
+	case forwardedHeaderForwarded:
+		chain = getForwardedHeaderChain(r)
+	case forwardedHeaderRealIP:
+		if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+			chain = []string{realIP}
+		}
+	default:
+		chain = getForwardedForChain(r)
+	}
+
+	clientIP := remoteIP
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, err := parseForwardedAddr(chain[i])
+		if err != nil {
+			// hops behind an unparsable entry cannot be verified
+			break
+		}
+
+		clientIP = addr.String()
+
+		if !proxy.isTrustedProxy(clientIP) {
+			break
+		}
+	}
+
+	return clientIP
+}
+
+// isTrustedProxy returns true if the forwarding headers set by the IP can be trusted.
+func (proxy *BeaconProxy) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+
+	for _, prefix := range proxy.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isTrustedRemote returns true if the forwarding headers of the request come from a trusted proxy.
+func (proxy *BeaconProxy) isTrustedRemote(r *http.Request) bool {
+	if len(proxy.trustedProxies) == 0 {
+		return proxy.config.ProxyCount > 0
+	}
+
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+
+	return proxy.isTrustedProxy(remoteIP)
+}
+
+// getForwardedForChain returns the entries of all X-Forwarded-For headers, the nearest hop is the last entry.
+func getForwardedForChain(r *http.Request) []string {
+	chain := []string{}
+
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, entry := range strings.Split(header, ",") {
+			chain = append(chain, strings.TrimSpace(entry))
+		}
+	}
+
+	return chain
+}
+
+// getForwardedHeaderChain returns the "for" parameters of all RFC 7239 Forwarded headers, the nearest hop is the last entry.
+func getForwardedHeaderChain(r *http.Request) []string {
+	chain := []string{}
+
+	for _, header := range r.Header.Values("Forwarded") {
+		for _, element := range strings.Split(header, ",") {
+			forValue := ""
+
+			for _, pair := range strings.Split(element, ";") {
+				key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if found && strings.EqualFold(key, "for") {
+					forValue = strings.Trim(value, "\"")
+				}
+			}
+
+			chain = append(chain, forValue)
+		}
+	}
+
+	return chain
+}
+
+// parseForwardedAddr parses the IP of a forwarding header entry ("1.2.3.4", "1.2.3.4:80", "[2001:db8::1]:80" or "2001:db8::1").
+func parseForwardedAddr(entry string) (netip.Addr, error) {
+	if addrPort, err := netip.ParseAddrPort(entry); err == nil {
+		return addrPort.Addr().Unmap(), nil
+	}
+
+	addr, err := netip.ParseAddr(strings.Trim(entry, "[]"))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid forwarded address '%v'", entry)
+	}
+
+	return addr.Unmap(), nil
+}
+
+// setForwardingHeaders sets the X-Forwarded-For, X-Forwarded-Proto and Via headers of an upstream request.
+// The forwarding headers of the client are only kept if they come from a trusted proxy.
+func (proxy *BeaconProxy) setForwardingHeaders(header http.Header, r *http.Request) {
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+
+	trustedRemote := proxy.isTrustedRemote(r)
+
+	forwardedFor := []string{}
+	if trustedRemote {
+		for _, entry := range getForwardedForChain(r) {
+			if entry != "" {
+				forwardedFor = append(forwardedFor, entry)
+			}
+		}
+	}
+
+	forwardedFor = append(forwardedFor, remoteIP)
+	header.Set("X-Forwarded-For", strings.Join(forwardedFor, ", "))
+
+	forwardedProto := ""
+	if trustedRemote {
+		forwardedProto = r.Header.Get("X-Forwarded-Proto")
+	}
+
+	if forwardedProto == "" {
+		forwardedProto = "http"
+		if r.TLS != nil {
+			forwardedProto = "https"
+		}
+	}
+
+	header.Set("X-Forwarded-Proto", forwardedProto)
+
+	via := r.Header.Values("Via")
+	via = append(via, fmt.Sprintf("%v dugtrio", getViaProtocol(r)))
+	header.Set("Via", strings.Join(via, ", "))
+}
+
+// getViaProtocol returns the protocol version of the request in Via header notation ("1.1", "2").
+func getViaProtocol(r *http.Request) string {
+	if r.ProtoMajor >= 2 {
+		return fmt.Sprintf("%v", r.ProtoMajor)
+	}
+
+	return fmt.Sprintf("%v.%v", r.ProtoMajor, r.ProtoMinor)
+}
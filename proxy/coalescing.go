@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/ethpandaops/dugtrio/pool"
+	"github.com/ethpandaops/dugtrio/utils"
+)
+
+// coalesceMaxResponseSize limits the response size that is buffered for the requests waiting on a coalesced call.
+const coalesceMaxResponseSize = 32 * 1024 * 1024
+
+// coalescedCall is an in-flight upstream call that is shared by all concurrent identical requests.
+// The leading request buffers the response in the call, all waiting requests are served from there once it is complete.
+type coalescedCall struct {
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	header http.Header
+	status int
+	data   []byte
+	done   bool
+	// aborted is set if the leading request failed to stream the complete response
+	aborted bool
+	// oversized is set if the response exceeded the buffer limit, the call is no longer shared then
+	oversized bool
+}
+
+// coalescingResponseWriter wraps the response writer of the leading request and copies the response into the coalesced call.
+type coalescingResponseWriter struct {
+	http.ResponseWriter
+	call *coalescedCall
+}
+
+func (proxy *BeaconProxy) getCoalesceKey(r *http.Request, clientType pool.ClientType) string {
+	if r.Method != http.MethodGet || len(proxy.coalescePaths) == 0 {
+		return ""
+	}
+
+	if isEventStreamRequest(r) {
+		return ""
+	}
+
+	matched := false
+
+	for _, coalescePathPattern := range proxy.coalescePaths {
+		if coalescePathPattern.MatchString(r.URL.EscapedPath()) {
+			matched = true
+			break
+		}
+	}
+
+	if !matched {
+		return ""
+	}
+
+	keyHash := sha256.New()
+	fmt.Fprintf(keyHash, "%d\n%s\n%s\n%s\n%s\n%s", clientType, getNextEndpointOverride(r), path.Clean(r.URL.Path), r.URL.Query().Encode(), strings.TrimSpace(r.Header.Get("Accept")), strings.TrimSpace(r.Header.Get("Accept-Encoding")))
+
+	return hex.EncodeToString(keyHash.Sum(nil))
+}
+
+// joinCoalescedCall returns the in-flight call for the key. If there is none, a new call is created and the caller becomes its leader.
+func (proxy *BeaconProxy) joinCoalescedCall(key string) (*coalescedCall, bool) {
+	proxy.coalesceMutex.Lock()
+	defer proxy.coalesceMutex.Unlock()
+
+	if call := proxy.coalescedCalls[key]; call != nil {
+		return call, false
+	}
+
+	call := &coalescedCall{}
+	call.cond = sync.NewCond(&call.mutex)
+	proxy.coalescedCalls[key] = call
+
+	return call, true
+}
+
+func (proxy *BeaconProxy) finishCoalescedCall(key string, call *coalescedCall) {
+	proxy.coalesceMutex.Lock()
+	if proxy.coalescedCalls[key] == call {
+		delete(proxy.coalescedCalls, key)
+	}
+	proxy.coalesceMutex.Unlock()
+
+	call.mutex.Lock()
+	call.done = true
+	call.mutex.Unlock()
+	call.cond.Broadcast()
+}
+
+// abort marks the response of the leading request as incomplete.
+func (call *coalescedCall) abort() {
+	call.mutex.Lock()
+	call.aborted = true
+	call.mutex.Unlock()
+}
+
+func (rw *coalescingResponseWriter) WriteHeader(statusCode int) {
+	rw.call.mutex.Lock()
+	if rw.call.status == 0 {
+		rw.call.status = statusCode
+		rw.call.header = rw.ResponseWriter.Header().Clone()
+	}
+	rw.call.mutex.Unlock()
+	rw.call.cond.Broadcast()
+
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *coalescingResponseWriter) Write(data []byte) (int, error) {
+	rw.call.mutex.Lock()
+	if rw.call.status == 0 {
+		rw.call.status = http.StatusOK
+		rw.call.header = rw.ResponseWriter.Header().Clone()
+	}
+
+	if !rw.call.oversized {
+		if len(rw.call.data)+len(data) > coalesceMaxResponseSize {
+			// stop sharing the response, the waiting requests do their own upstream calls
+			rw.call.oversized = true
+			rw.call.data = nil
+		} else {
+			rw.call.data = append(rw.call.data, data...)
+		}
+	}
+	rw.call.mutex.Unlock()
+	rw.call.cond.Broadcast()
+
+	return rw.ResponseWriter.Write(data)
+}
+
+func (rw *coalescingResponseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// serve writes the response of the leading request to a waiting request once it is complete.
+// Returns false if the leading request failed, was aborted by its client or the response exceeded the buffer limit,
+// the waiting request has to do its own upstream call then. The response is only written after the leading request
+// finished, so the waiting requests never depend on the connection of the leading client.
+func (call *coalescedCall) serve(w http.ResponseWriter, session *Session) (bool, error) {
+	call.mutex.Lock()
+	for !call.done && !call.oversized {
+		call.cond.Wait()
+	}
+
+	if call.status == 0 || call.aborted || call.oversized {
+		call.mutex.Unlock()
+		return false, nil
+	}
+
+	// only the upstream response headers are shared, the rate limit & cache headers belong to the leading request
+	respH := w.Header()
+	for _, hk := range passthruResponseHeaderKeys {
+		if hv, ok := call.header[hk]; ok {
+			respH[hk] = hv
+		}
+	}
+
+	for hk, hv := range call.header {
+		if strings.HasPrefix(hk, "X-Dugtrio-Endpoint-") {
+			respH[hk] = hv
+		}
+	}
+
+	data := call.data
+	call.mutex.Unlock()
+
+	respH.Set("X-Dugtrio-Version", fmt.Sprintf("dugtrio/%v", utils.GetVersion()))
+	respH.Set("X-Dugtrio-Session-Ip", session.group.GetIPAddr())
+	respH.Set("X-Dugtrio-Coalesced", "true")
+	w.WriteHeader(call.status)
+
+	_, err := w.Write(data)
+
+	return true, err
+}
@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ethpandaops/dugtrio/pool"
+)
+
+const eventDedupSize = 1024
+
+// eventDeduplicator remembers the most recently forwarded events, so events that are
+// received again after switching the upstream endpoint can be skipped.
+type eventDeduplicator struct {
+	keys  map[string]bool
+	order []string
+	pos   int
+}
+
+func newEventDeduplicator() *eventDeduplicator {
+	return &eventDeduplicator{
+		keys:  make(map[string]bool, eventDedupSize),
+		order: make([]string, 0, eventDedupSize),
+	}
+}
+
+// getEventDedupKey identifies an event by its block root and slot (or epoch). Events without these fields are identified by their payload.
+func getEventDedupKey(evt *sseEvent) string {
+	fields := struct {
+		Slot      string `json:"slot"`
+		Epoch     string `json:"epoch"`
+		Block     string `json:"block"`
+		BlockRoot string `json:"block_root"`
+		Root      string `json:"root"`
+		Index     string `json:"index"`
+	}{}
+
+	if err := json.Unmarshal(evt.data, &fields); err == nil {
+		root := fields.Block
+		if root == "" {
+			root = fields.BlockRoot
+		}
+
+		if root == "" {
+			root = fields.Root
+		}
+
+		switch {
+		case root != "" && fields.Slot != "":
+			return fmt.Sprintf("%s:%s:%s:%s", evt.event, fields.Slot, root, fields.Index)
+		case root != "" && fields.Epoch != "":
+			return fmt.Sprintf("%s:e%s:%s", evt.event, fields.Epoch, root)
+		}
+	}
+
+	dataHash := sha256.Sum256(evt.data)
+
+	return fmt.Sprintf("%s:%s", evt.event, hex.EncodeToString(dataHash[:]))
+}
+
+// isDuplicate returns true if the event has been seen before, otherwise the event is remembered.
+func (dedup *eventDeduplicator) isDuplicate(evt *sseEvent) bool {
+	if len(evt.data) == 0 {
+		// comments & keepalives
+		return false
+	}
+
+	key := getEventDedupKey(evt)
+	if dedup.keys[key] {
+		return true
+	}
+
+	if len(dedup.order) < eventDedupSize {
+		dedup.order = append(dedup.order, key)
+	} else {
+		delete(dedup.keys, dedup.order[dedup.pos])
+		dedup.order[dedup.pos] = key
+		dedup.pos = (dedup.pos + 1) % eventDedupSize
+	}
+
+	dedup.keys[key] = true
+
+	return false
+}
+
+func formatEventStreamSwitchComment(oldEndpoint, newEndpoint *pool.Client) []byte {
+	oldName := "none"
+	if oldEndpoint != nil {
+		oldName = oldEndpoint.GetName()
+	}
+
+	return []byte(fmt.Sprintf(": dugtrio switched upstream endpoint (%v -> %v)\n\n", oldName, newEndpoint.GetName()))
+}
+
+// watchEndpointReadiness cancels the call context when the endpoint is no longer ready. The returned function stops the watcher.
+func (proxy *BeaconProxy) watchEndpointReadiness(callContext *proxyCallContext, endpoint *pool.Client) func() {
+	stopChan := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopChan:
+				return
+			case <-callContext.context.Done():
+				return
+			case <-ticker.C:
+				if !proxy.pool.IsClientReady(endpoint) {
+					callContext.cancelFn()
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(stopChan)
+	}
+}
+
+// resubscribeEventStream opens the event stream of the request on the next available endpoint.
+// It retries until the call timeout passed or the client disconnected.
+func (proxy *BeaconProxy) resubscribeEventStream(r *http.Request, session *Session) (*pool.Client, *proxyCallContext, uint64, io.ReadCloser) {
+	deadline := time.Now().Add(proxy.config.CallTimeout)
+
+	for r.Context().Err() == nil && time.Now().Before(deadline) {
+		endpoint, err := proxy.getEndpointForCall(r, session, session.prefix)
+		if err == nil && endpoint != nil && proxy.pool.IsClientReady(endpoint) {
+			callContext := proxy.newProxyCallContext(r.Context(), proxy.config.CallTimeout)
+			contextID := session.addActiveContext(callContext.cancelFn)
+
+			resp, err := proxy.sendProxyRequest(callContext, r, http.NoBody, 0, endpoint)
+			if err == nil && resp.StatusCode == http.StatusOK {
+				return endpoint, callContext, contextID, resp.Body
+			}
+
+			if err == nil {
+				resp.Body.Close()
+				err = fmt.Errorf("unexpected status %v", resp.StatusCode)
+			}
+
+			proxy.logger.WithField("endpoint", endpoint.GetName()).Debugf("error resubscribing event stream: %v", err)
+
+			callContext.cancelFn()
+			session.removeActiveContext(contextID)
+		}
+
+		select {
+		case <-r.Context().Done():
+		case <-time.After(1 * time.Second):
+		}
+	}
+
+	return nil, nil, 0, nil
+}
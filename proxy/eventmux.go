@@ -0,0 +1,610 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ethpandaops/dugtrio/pool"
+	"github.com/ethpandaops/dugtrio/types"
+	"github.com/ethpandaops/dugtrio/utils"
+)
+
+const (
+	slowConsumerDisconnect = "disconnect"
+	slowConsumerDrop       = "drop"
+)
+
+// eventMultiplexer shares one upstream event stream per topic set between all downstream subscribers.
+type eventMultiplexer struct {
+	proxy   *BeaconProxy
+	config  *types.EventMuxConfig
+	logger  *logrus.Entry
+	mutex   sync.Mutex
+	streams map[string]*eventMuxStream
+}
+
+type eventMuxStream struct {
+	mux        *eventMultiplexer
+	key        string
+	label      string
+	topics     string
+	topicList  []string
+	clientType pool.ClientType
+	ctx        context.Context
+	cancelFn   context.CancelFunc
+	readyChan  chan struct{}
+	readyOnce  sync.Once
+	dedup      *eventDeduplicator
+
+	mutex        sync.Mutex
+	closed       bool
+	idleTimer    *time.Timer
+	subscribers  map[uint64]*eventMuxSubscriber
+	nextID       uint64
+	endpoint     *pool.Client
+	failedStatus int
+	failedBody   []byte
+}
+
+type eventMuxSubscriber struct {
+	id        uint64
+	events    chan *eventMuxEvent
+	closeChan chan struct{}
+	closeOnce sync.Once
+}
+
+// eventMuxEvent is an event forwarded to the subscribers. The id is the dugtrio event ID (0 = not buffered for replay).
+type eventMuxEvent struct {
+	id   uint64
+	data []byte
+}
+
+func newEventMultiplexer(proxy *BeaconProxy, config *types.EventMuxConfig) *eventMultiplexer {
+	if config.SubscriberBuffer == 0 {
+		config.SubscriberBuffer = 256
+	}
+
+	switch config.SlowConsumerPolicy {
+	case slowConsumerDisconnect, slowConsumerDrop:
+	case "":
+		config.SlowConsumerPolicy = slowConsumerDisconnect
+	default:
+		proxy.logger.Warnf("unknown event mux slowConsumerPolicy '%v', using '%v'", config.SlowConsumerPolicy, slowConsumerDisconnect)
+		config.SlowConsumerPolicy = slowConsumerDisconnect
+	}
+
+	if config.GracePeriod == 0 && proxy.config.EventReplaySize > 0 {
+		config.GracePeriod = 5 * time.Minute
+	}
+
+	return &eventMultiplexer{
+		proxy:   proxy,
+		config:  config,
+		logger:  logrus.WithField("module", "eventmux"),
+		streams: make(map[string]*eventMuxStream),
+	}
+}
+
+// getStream returns the shared stream for the topic set. The topics must be sorted and validated against the known
+// topics, as they are used for the metric labels.
+func (mux *eventMultiplexer) getStream(topics []string, clientType pool.ClientType) *eventMuxStream {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+
+	topicsStr := strings.Join(topics, ",")
+	key := fmt.Sprintf("%d:%s", clientType, topicsStr)
+
+	label := topicsStr
+	if clientType != pool.UnspecifiedClient {
+		label = fmt.Sprintf("%v:%v", clientType.String(), topicsStr)
+	}
+
+	stream := mux.streams[key]
+	if stream == nil {
+		stream = &eventMuxStream{
+			mux:         mux,
+			key:         key,
+			label:       label,
+			topics:      topicsStr,
+			topicList:   topics,
+			clientType:  clientType,
+			readyChan:   make(chan struct{}),
+			dedup:       newEventDeduplicator(),
+			subscribers: make(map[uint64]*eventMuxSubscriber),
+		}
+		stream.ctx, stream.cancelFn = context.WithCancel(context.Background())
+		mux.streams[key] = stream
+
+		go stream.run()
+	}
+
+	return stream
+}
+
+func (mux *eventMultiplexer) removeStream(stream *eventMuxStream) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+
+	if mux.streams[stream.key] == stream {
+		delete(mux.streams, stream.key)
+	}
+}
+
+// serve subscribes the downstream request to the shared upstream stream and forwards all events until either side disconnects.
+func (mux *eventMultiplexer) serve(w http.ResponseWriter, r *http.Request, session *Session, clientType pool.ClientType) {
+	topics := getEventStreamTopics(r)
+	if len(topics) == 0 {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusBadRequest)
+
+		_, err := w.Write([]byte("No event topics requested"))
+		if err != nil {
+			mux.logger.Warnf("error writing bad request response: %v", err)
+		}
+
+		return
+	}
+
+	var stream *eventMuxStream
+
+	var subscriber *eventMuxSubscriber
+
+	for subscriber == nil {
+		// the stream might get closed concurrently, retry with a new stream in that case
+		stream = mux.getStream(topics, clientType)
+		subscriber = stream.subscribe()
+	}
+
+	defer stream.unsubscribe(subscriber)
+
+	select {
+	case <-stream.readyChan:
+	case <-r.Context().Done():
+		return
+	}
+
+	stream.mutex.Lock()
+	endpoint := stream.endpoint
+	failedStatus := stream.failedStatus
+	failedBody := stream.failedBody
+	stream.mutex.Unlock()
+
+	respH := w.Header()
+	respH.Set("X-Dugtrio-Version", fmt.Sprintf("dugtrio/%v", utils.GetVersion()))
+	respH.Set("X-Dugtrio-Session-Ip", session.group.GetIPAddr())
+
+	if failedStatus != 0 {
+		respH.Set("Content-Type", "application/json")
+		w.WriteHeader(failedStatus)
+
+		_, err := w.Write(failedBody)
+		if err != nil {
+			mux.logger.Warnf("error writing event stream error response: %v", err)
+		}
+
+		return
+	}
+
+	if endpoint != nil {
+		respH.Set("X-Dugtrio-Endpoint-Name", endpoint.GetName())
+		respH.Set("X-Dugtrio-Endpoint-Type", endpoint.GetClientType().String())
+		respH.Set("X-Dugtrio-Endpoint-Version", endpoint.GetVersion())
+	}
+
+	respH.Set("Content-Type", "text/event-stream")
+	respH.Set("Cache-Control", "no-cache")
+	respH.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	replayed, _, err := mux.proxy.replayEvents(w, r)
+	if err != nil {
+		return
+	}
+
+	for {
+		select {
+		case evt := <-subscriber.events:
+			if replayed[evt.id] {
+				continue
+			}
+
+			_, err := w.Write(evt.data)
+			if err != nil {
+				return
+			}
+
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+
+			now := time.Now()
+			session.group.lastSeen = now
+			session.lastSeen = now
+		case <-subscriber.closeChan:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (stream *eventMuxStream) subscribe() *eventMuxSubscriber {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	if stream.closed {
+		return nil
+	}
+
+	subscriber := &eventMuxSubscriber{
+		id:        stream.nextID,
+		events:    make(chan *eventMuxEvent, stream.mux.config.SubscriberBuffer),
+		closeChan: make(chan struct{}),
+	}
+	stream.nextID++
+	stream.subscribers[subscriber.id] = subscriber
+
+	if stream.idleTimer != nil {
+		stream.idleTimer.Stop()
+		stream.idleTimer = nil
+	}
+
+	stream.updateMetrics()
+
+	return subscriber
+}
+
+func (stream *eventMuxStream) unsubscribe(subscriber *eventMuxSubscriber) {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	delete(stream.subscribers, subscriber.id)
+	subscriber.close()
+
+	stream.updateMetrics()
+
+	if len(stream.subscribers) == 0 && stream.idleTimer == nil {
+		// last subscriber left, close the upstream stream after the grace period
+		var idleTimer *time.Timer
+
+		idleTimer = time.AfterFunc(stream.mux.config.GracePeriod, func() {
+			stream.closeIdle(idleTimer)
+		})
+		stream.idleTimer = idleTimer
+	}
+}
+
+// closeIdle closes the upstream stream if no subscriber joined within the grace period.
+func (stream *eventMuxStream) closeIdle(idleTimer *time.Timer) {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	if stream.idleTimer != idleTimer {
+		// a subscriber joined in the meantime, the timer has been stopped or replaced
+		return
+	}
+
+	stream.idleTimer = nil
+
+	if len(stream.subscribers) > 0 || stream.closed {
+		return
+	}
+
+	stream.closed = true
+	stream.mux.removeStream(stream)
+	stream.cancelFn()
+}
+
+func (subscriber *eventMuxSubscriber) close() {
+	subscriber.closeOnce.Do(func() {
+		close(subscriber.closeChan)
+	})
+}
+
+// broadcast forwards an event to all subscribers. Subscribers with a full buffer are handled according to the slow consumer policy.
+func (stream *eventMuxStream) broadcast(evt *eventMuxEvent) {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	for id, subscriber := range stream.subscribers {
+		select {
+		case subscriber.events <- evt:
+			continue
+		default:
+		}
+
+		if stream.mux.config.SlowConsumerPolicy == slowConsumerDrop {
+			// drop the oldest buffered event to make room for the new one
+			select {
+			case <-subscriber.events:
+			default:
+			}
+
+			select {
+			case subscriber.events <- evt:
+			default:
+			}
+
+			stream.addDroppedMetric("event")
+
+			continue
+		}
+
+		stream.mux.logger.Infof("dropping slow event stream subscriber (topics: %v)", stream.label)
+		delete(stream.subscribers, id)
+		subscriber.close()
+		stream.addDroppedMetric("subscriber")
+	}
+
+	stream.updateMetrics()
+
+	if stream.mux.proxy.proxyMetrics != nil {
+		stream.mux.proxy.proxyMetrics.AddEventMuxEvent(stream.label)
+	}
+}
+
+func (stream *eventMuxStream) closeSubscribers() {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	stream.closed = true
+
+	for _, subscriber := range stream.subscribers {
+		subscriber.close()
+	}
+}
+
+func (stream *eventMuxStream) setReady() {
+	stream.readyOnce.Do(func() {
+		close(stream.readyChan)
+	})
+}
+
+func (stream *eventMuxStream) run() {
+	defer utils.HandleSubroutinePanic("proxy.eventmux.stream", nil)
+
+	defer func() {
+		stream.mux.removeStream(stream)
+		stream.cancelFn()
+		stream.setReady()
+		stream.closeSubscribers()
+		stream.setConnected(nil)
+
+		if stream.mux.proxy.proxyMetrics != nil {
+			stream.mux.proxy.proxyMetrics.RemoveEventMuxStream(stream.label)
+		}
+	}()
+
+	var lastEndpoint *pool.Client
+
+	for stream.ctx.Err() == nil {
+		endpoint := stream.mux.proxy.pool.GetReadyEndpoint(stream.clientType, 0)
+		if endpoint == nil {
+			select {
+			case <-stream.ctx.Done():
+			case <-time.After(1 * time.Second):
+			}
+
+			continue
+		}
+
+		resp, err := stream.connect(endpoint)
+		if err != nil {
+			stream.mux.logger.WithField("endpoint", endpoint.GetName()).Warnf("error subscribing upstream event stream (topics: %v): %v", stream.label, err)
+
+			select {
+			case <-stream.ctx.Done():
+			case <-time.After(1 * time.Second):
+			}
+
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			// the upstream rejected the subscription (most likely invalid topics), pass the error to all subscribers
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+
+			stream.mutex.Lock()
+			stream.failedStatus = resp.StatusCode
+			stream.failedBody = body
+			stream.mutex.Unlock()
+
+			return
+		}
+
+		if lastEndpoint != nil {
+			stream.mux.logger.Infof("switched upstream event stream (topics: %v): %v -> %v", stream.label, lastEndpoint.GetName(), endpoint.GetName())
+			stream.broadcast(&eventMuxEvent{
+				data: formatEventStreamSwitchComment(lastEndpoint, endpoint),
+			})
+
+			if stream.mux.proxy.proxyMetrics != nil {
+				stream.mux.proxy.proxyMetrics.AddEventStreamFailover(lastEndpoint.GetName(), endpoint.GetName())
+			}
+		}
+
+		if stream.mux.proxy.eventReplay != nil {
+			stream.mux.proxy.eventReplay.startRecording(stream.topicList)
+		}
+
+		stream.setConnected(endpoint)
+		stream.setReady()
+
+		err = stream.processUpstream(resp.Body, endpoint)
+		resp.Body.Close()
+
+		stream.setConnected(nil)
+
+		if stream.mux.proxy.eventReplay != nil {
+			stream.mux.proxy.eventReplay.stopRecording(stream.topicList)
+		}
+
+		if stream.ctx.Err() == nil {
+			stream.mux.logger.WithField("endpoint", endpoint.GetName()).Infof("upstream event stream closed (topics: %v): %v", stream.label, err)
+		}
+
+		// keep the subscribers connected and resubscribe on the next ready endpoint
+		lastEndpoint = endpoint
+	}
+}
+
+func (stream *eventMuxStream) connect(endpoint *pool.Client) (*http.Response, error) {
+	endpointConfig := endpoint.GetEndpointConfig()
+
+	streamURL, err := url.Parse(fmt.Sprintf("%s/eth/v1/events?topics=%s", endpointConfig.URL, url.QueryEscape(stream.topics)))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing event stream url: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(stream.ctx, http.MethodGet, streamURL.String(), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "text/event-stream")
+
+	for hk, hv := range endpointConfig.Headers {
+		req.Header.Add(hk, hv)
+	}
+
+	// the event stream has no overall timeout, but the upstream must send the response headers within the call timeout
+	connectCtx, connectCancel := context.WithCancel(stream.ctx)
+	headerTimeout := stream.mux.proxy.config.CallTimeout
+	headerTimer := time.AfterFunc(headerTimeout, connectCancel)
+
+	client := endpoint.GetHTTPClient()
+
+	resp, err := client.Do(req.WithContext(connectCtx))
+	if !headerTimer.Stop() && stream.ctx.Err() == nil {
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		connectCancel()
+
+		return nil, fmt.Errorf("no response headers within %v", headerTimeout)
+	}
+
+	if err != nil {
+		connectCancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelOnCloseBody{
+		ReadCloser: resp.Body,
+		cancelFn:   connectCancel,
+	}
+
+	return resp, nil
+}
+
+// cancelOnCloseBody releases the request context of an upstream stream when its body is closed.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancelFn context.CancelFunc
+}
+
+func (body *cancelOnCloseBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancelFn()
+
+	return err
+}
+
+func (stream *eventMuxStream) processUpstream(body io.Reader, endpoint *pool.Client) error {
+	idleTimeout := stream.mux.proxy.config.CallTimeout
+	idleCtx, idleCancel := context.WithCancel(stream.ctx)
+
+	defer idleCancel()
+
+	// switch to another endpoint when the current one is no longer ready
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-idleCtx.Done():
+				return
+			case <-ticker.C:
+				if !stream.mux.proxy.pool.IsClientReady(endpoint) {
+					idleCancel()
+					return
+				}
+			}
+		}
+	}()
+
+	// close the upstream stream if there was no event within the call timeout
+	idleTimer := time.AfterFunc(idleTimeout, idleCancel)
+	defer idleTimer.Stop()
+
+	go func() {
+		<-idleCtx.Done()
+
+		if closer, ok := body.(io.Closer); ok {
+			closer.Close()
+		}
+	}()
+
+	rd := bufio.NewReaderSize(body, 64*1024)
+
+	for {
+		evt, err := readSSEEvent(rd)
+		if err != nil {
+			return err
+		}
+
+		idleTimer.Reset(idleTimeout)
+
+		if stream.dedup.isDuplicate(evt) {
+			continue
+		}
+
+		muxEvent := &eventMuxEvent{
+			data: evt.raw,
+		}
+
+		if stream.mux.proxy.eventReplay != nil {
+			muxEvent.id, muxEvent.data = stream.mux.proxy.eventReplay.record(evt)
+		}
+
+		stream.broadcast(muxEvent)
+	}
+}
+
+func (stream *eventMuxStream) setConnected(endpoint *pool.Client) {
+	stream.mutex.Lock()
+	stream.endpoint = endpoint
+	stream.mutex.Unlock()
+
+	if stream.mux.proxy.proxyMetrics != nil {
+		stream.mux.proxy.proxyMetrics.SetEventMuxStreamConnected(stream.label, endpoint != nil)
+	}
+}
+
+func (stream *eventMuxStream) updateMetrics() {
+	if stream.mux.proxy.proxyMetrics != nil {
+		stream.mux.proxy.proxyMetrics.SetEventMuxSubscribers(stream.label, len(stream.subscribers))
+	}
+}
+
+func (stream *eventMuxStream) addDroppedMetric(reason string) {
+	if stream.mux.proxy.proxyMetrics != nil {
+		stream.mux.proxy.proxyMetrics.AddEventMuxDropped(stream.label, reason)
+	}
+}
@@ -0,0 +1,251 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// eventReplayBuffer keeps the most recent events per topic, so clients that reconnect with a
+// Last-Event-ID header get the events they missed replayed.
+// Events get dugtrio generated IDs, the same event received from different upstream streams gets the same ID.
+type eventReplayBuffer struct {
+	mutex   sync.Mutex
+	size    int
+	startID uint64
+	nextID  uint64
+	keys    map[string]*eventReplayEntry
+	topics  map[string]*eventReplayTopic
+}
+
+type eventReplayTopic struct {
+	entries   []*eventReplayEntry
+	pos       int
+	evictedID uint64
+	// recorders is the number of upstream streams currently recording the topic, all events with an ID higher
+	// than coveredSince have been recorded since the first of them connected
+	recorders    int
+	coveredSince uint64
+}
+
+type eventReplayEntry struct {
+	id  uint64
+	key string
+	raw []byte
+}
+
+func newEventReplayBuffer(size int) *eventReplayBuffer {
+	// start with the current time in ms, so IDs keep increasing across restarts
+	startID := uint64(time.Now().UnixMilli()) //nolint:gosec // no overflow
+
+	return &eventReplayBuffer{
+		size:    size,
+		startID: startID,
+		nextID:  startID,
+		keys:    make(map[string]*eventReplayEntry),
+		topics:  make(map[string]*eventReplayTopic),
+	}
+}
+
+// getLastEventID returns the Last-Event-ID of a reconnecting client (0 = none).
+func getLastEventID(r *http.Request) uint64 {
+	lastEventID, err := strconv.ParseUint(strings.TrimSpace(r.Header.Get("Last-Event-ID")), 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return lastEventID
+}
+
+// formatReplayEvent replaces the upstream event ID with the dugtrio event ID.
+func formatReplayEvent(evt *sseEvent, id uint64) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, len(evt.raw)+24))
+	fmt.Fprintf(buf, "id: %d\n", id)
+
+	for _, line := range bytes.Split(evt.raw, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			continue
+		}
+
+		if field, _, _ := bytes.Cut(line, []byte(":")); string(field) == "id" {
+			continue
+		}
+
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	buf.WriteByte('\n')
+
+	return buf.Bytes()
+}
+
+// record adds the event to the buffer and returns its dugtrio event ID and the event with the ID applied.
+// Comments and keepalives are returned unchanged with ID 0.
+func (replay *eventReplayBuffer) record(evt *sseEvent) (uint64, []byte) {
+	if len(evt.data) == 0 {
+		return 0, evt.raw
+	}
+
+	key := getEventDedupKey(evt)
+
+	replay.mutex.Lock()
+	defer replay.mutex.Unlock()
+
+	if entry := replay.keys[key]; entry != nil {
+		return entry.id, entry.raw
+	}
+
+	topic := replay.getTopic(evt.event)
+
+	replay.nextID++
+
+	entry := &eventReplayEntry{
+		id:  replay.nextID,
+		key: key,
+		raw: formatReplayEvent(evt, replay.nextID),
+	}
+
+	if len(topic.entries) < replay.size {
+		topic.entries = append(topic.entries, entry)
+	} else {
+		topic.evictedID = topic.entries[topic.pos].id
+		delete(replay.keys, topic.entries[topic.pos].key)
+
+		topic.entries[topic.pos] = entry
+		topic.pos = (topic.pos + 1) % replay.size
+	}
+
+	replay.keys[key] = entry
+
+	return entry.id, entry.raw
+}
+
+func (replay *eventReplayBuffer) getTopic(topicName string) *eventReplayTopic {
+	topic := replay.topics[topicName]
+	if topic == nil {
+		topic = &eventReplayTopic{
+			entries: make([]*eventReplayEntry, 0, replay.size),
+		}
+		replay.topics[topicName] = topic
+	}
+
+	return topic
+}
+
+// startRecording is called when an upstream stream with the topics connected. Events that happened while no
+// upstream stream recorded a topic are lost, so replays across such a gap are incomplete.
+func (replay *eventReplayBuffer) startRecording(topics []string) {
+	replay.mutex.Lock()
+	defer replay.mutex.Unlock()
+
+	for _, topicName := range topics {
+		topic := replay.getTopic(topicName)
+		if topic.recorders == 0 {
+			topic.coveredSince = replay.nextID
+		}
+
+		topic.recorders++
+	}
+}
+
+// stopRecording is called when an upstream stream with the topics ended.
+func (replay *eventReplayBuffer) stopRecording(topics []string) {
+	replay.mutex.Lock()
+	defer replay.mutex.Unlock()
+
+	for _, topicName := range topics {
+		if topic := replay.topics[topicName]; topic != nil && topic.recorders > 0 {
+			topic.recorders--
+		}
+	}
+}
+
+// getEventsSince returns all buffered events of the topics with an ID higher than lastEventID, ordered by ID.
+// Returns false if the events since lastEventID can't be replayed completely, because the ID has not been issued
+// by this instance, a topic was not recorded continuously since then or newer events have already been evicted.
+func (replay *eventReplayBuffer) getEventsSince(lastEventID uint64, topics []string) ([]*eventReplayEntry, bool) {
+	replay.mutex.Lock()
+	defer replay.mutex.Unlock()
+
+	if lastEventID <= replay.startID || lastEventID > replay.nextID {
+		return nil, false
+	}
+
+	entries := []*eventReplayEntry{}
+
+	for _, topicName := range topics {
+		topic := replay.topics[topicName]
+		if topic == nil || topic.recorders == 0 || topic.coveredSince > lastEventID || topic.evictedID > lastEventID {
+			return nil, false
+		}
+
+		for _, entry := range topic.entries {
+			if entry.id > lastEventID {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].id < entries[j].id
+	})
+
+	return entries, true
+}
+
+// replayEvents writes the missed events to a reconnecting client and returns the IDs of all replayed events,
+// so they can be skipped when they are received again from the live stream.
+func (proxy *BeaconProxy) replayEvents(w http.ResponseWriter, r *http.Request) (map[uint64]bool, int64, error) {
+	replayed := map[uint64]bool{}
+
+	lastEventID := getLastEventID(r)
+	if proxy.eventReplay == nil || lastEventID == 0 {
+		return replayed, 0, nil
+	}
+
+	written := int64(0)
+
+	entries, complete := proxy.eventReplay.getEventsSince(lastEventID, getEventStreamTopics(r))
+	if !complete {
+		// replaying a partial history would hide the gap from the client
+		wb, err := fmt.Fprintf(w, ": dugtrio can't replay events since %v, missed events are no longer available\n\n", lastEventID)
+		if err != nil {
+			return replayed, int64(wb), err
+		}
+
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		proxy.logger.Debugf("can't replay events since %v, not in replay buffer", lastEventID)
+
+		return replayed, int64(wb), nil
+	}
+
+	for _, entry := range entries {
+		wb, err := w.Write(entry.raw)
+		if err != nil {
+			return replayed, written, err
+		}
+
+		written += int64(wb)
+		replayed[entry.id] = true
+	}
+
+	if len(entries) > 0 {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		proxy.logger.Debugf("replayed %v events since %v", len(entries), lastEventID)
+	}
+
+	return replayed, written, nil
+}
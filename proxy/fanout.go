@@ -0,0 +1,210 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethpandaops/dugtrio/pool"
+	"github.com/ethpandaops/dugtrio/utils"
+)
+
+// fanoutMaxResponseSize limits the response size that is buffered for each endpoint of a fan-out call.
+const fanoutMaxResponseSize = 128 * 1024 * 1024
+
+// fanoutResult is the buffered response of one endpoint of a fan-out call.
+type fanoutResult struct {
+	endpoint *pool.Client
+	callPath string
+	status   int
+	header   http.Header
+	body     []byte
+	duration time.Duration
+	err      error
+}
+
+func (result *fanoutResult) isSuccess() bool {
+	return result.err == nil && result.status >= 200 && result.status < 300
+}
+
+// getFanoutEndpoints returns up to limit ready endpoints (0 = all) in random order.
+// The last endpoint of the session comes first, so it is always included.
+func (proxy *BeaconProxy) getFanoutEndpoints(session *Session, clientType pool.ClientType, limit int) []*pool.Client {
+	readyEndpoints := session.group.filterEndpoints(proxy.pool.GetReadyEndpoints(clientType, 0))
+	endpoints := make([]*pool.Client, 0, len(readyEndpoints))
+
+	lastEndpoint := session.lastPoolClient
+	for _, endpoint := range readyEndpoints {
+		if endpoint == lastEndpoint {
+			endpoints = append(endpoints, endpoint)
+			break
+		}
+	}
+
+	for _, idx := range rand.Perm(len(readyEndpoints)) {
+		if readyEndpoints[idx] != lastEndpoint {
+			endpoints = append(endpoints, readyEndpoints[idx])
+		}
+	}
+
+	if limit > 0 && len(endpoints) > limit {
+		endpoints = endpoints[:limit]
+	}
+
+	return endpoints
+}
+
+// readRequestBody buffers the request body, so it can be sent to multiple endpoints.
+// Bodies exceeding the configured maximum size are rejected with 413.
+func (proxy *BeaconProxy) readRequestBody(w http.ResponseWriter, r *http.Request) ([]byte, *apiErrorResponse) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, proxy.config.MaxRequestBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, &apiErrorResponse{
+				Code:    http.StatusRequestEntityTooLarge,
+				Message: fmt.Sprintf("request body exceeds the maximum size of %v bytes", maxBytesErr.Limit),
+			}
+		}
+
+		return nil, &apiErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("error reading request body: %v", err),
+		}
+	}
+
+	return body, nil
+}
+
+// fanoutCall sends the request to all endpoints in parallel. The results are delivered in the order the calls complete,
+// the returned channel is buffered for all results.
+func (proxy *BeaconProxy) fanoutCall(ctx context.Context, r *http.Request, body []byte, endpoints []*pool.Client) <-chan *fanoutResult {
+	results := make(chan *fanoutResult, len(endpoints))
+
+	for _, endpoint := range endpoints {
+		go func() {
+			defer utils.HandleSubroutinePanic("proxy.fanout", nil)
+
+			results <- proxy.sendFanoutRequest(ctx, r, body, endpoint)
+		}()
+	}
+
+	return results
+}
+
+func (proxy *BeaconProxy) sendFanoutRequest(ctx context.Context, r *http.Request, body []byte, endpoint *pool.Client) *fanoutResult {
+	result := &fanoutResult{
+		endpoint: endpoint,
+		callPath: fmt.Sprintf("%s%s", r.Method, r.URL.EscapedPath()),
+	}
+
+	callContext := proxy.newProxyCallContext(ctx, proxy.config.CallTimeout)
+	defer callContext.cancelFn()
+
+	var reqBody io.ReadCloser = http.NoBody
+	if body != nil {
+		reqBody = io.NopCloser(bytes.NewReader(body))
+	}
+
+	start := time.Now()
+
+	resp, err := proxy.sendProxyRequest(callContext, r, reqBody, int64(len(body)), endpoint)
+	if err != nil {
+		result.err = err
+		result.duration = time.Since(start)
+
+		return result
+	}
+
+	defer resp.Body.Close()
+
+	result.status = resp.StatusCode
+	result.header = resp.Header
+	result.body, result.err = io.ReadAll(io.LimitReader(resp.Body, fanoutMaxResponseSize))
+	result.duration = time.Since(start)
+
+	return result
+}
+
+// writeFanoutResult writes the buffered response of an endpoint to the client.
+// Only the call that answers the client is counted as proxied call, the other fan-out calls (and the background
+// calls of the shadow checker) would inflate the per-endpoint call stats.
+func (proxy *BeaconProxy) writeFanoutResult(w http.ResponseWriter, session *Session, result *fanoutResult) error {
+	if proxy.proxyMetrics != nil {
+		proxy.proxyMetrics.AddCall(result.endpoint.GetName(), result.callPath, result.duration, result.status)
+	}
+
+	respH := w.Header()
+
+	for _, hk := range passthruResponseHeaderKeys {
+		if hv, ok := result.header[hk]; ok {
+			respH[hk] = hv
+		}
+	}
+
+	respH.Set("X-Dugtrio-Version", fmt.Sprintf("dugtrio/%v", utils.GetVersion()))
+	respH.Set("X-Dugtrio-Session-Ip", session.group.GetIPAddr())
+	respH.Set("X-Dugtrio-Endpoint-Name", result.endpoint.GetName())
+	respH.Set("X-Dugtrio-Endpoint-Type", result.endpoint.GetClientType().String())
+	respH.Set("X-Dugtrio-Endpoint-Version", result.endpoint.GetVersion())
+	w.WriteHeader(result.status)
+
+	_, err := w.Write(result.body)
+
+	return err
+}
+
+func getFanoutErrorMessage(result *fanoutResult) string {
+	if result.err != nil {
+		return result.err.Error()
+	}
+
+	return fmt.Sprintf("status %d: %v", result.status, parseAPIError(result.status, result.body).Message)
+}
+
+// getFanoutError aggregates the errors of all endpoints of a fan-out call. Client errors (4xx) take precedence, as they most likely
+// indicate an invalid message rather than an endpoint failure.
+func getFanoutError(action string, failed []*fanoutResult) *apiErrorResponse {
+	var selected *fanoutResult
+
+	messages := make([]string, 0, len(failed))
+
+	for _, result := range failed {
+		messages = append(messages, fmt.Sprintf("%v: %v", result.endpoint.GetName(), getFanoutErrorMessage(result)))
+
+		if result.err != nil {
+			continue
+		}
+
+		isClientError := result.status >= 400 && result.status < 500
+		if selected == nil || (isClientError && selected.status >= 500) {
+			selected = result
+		}
+	}
+
+	response := &apiErrorResponse{
+		Code:    http.StatusServiceUnavailable,
+		Message: fmt.Sprintf("%v failed on all endpoints (%v)", action, strings.Join(messages, "; ")),
+	}
+
+	if selected != nil {
+		response.Code = selected.status
+		response.Failures = parseAPIError(selected.status, selected.body).Failures
+
+		if response.Code < 400 {
+			response.Code = http.StatusBadGateway
+		}
+	}
+
+	return response
+}
@@ -0,0 +1,262 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ethpandaops/dugtrio/pool"
+)
+
+const (
+	hedgeLatencySamples    = 200
+	hedgeLatencyMinSamples = 20
+)
+
+// latencyTracker keeps a ring buffer of recent response header latencies for a hedged path pattern.
+type latencyTracker struct {
+	mutex   sync.Mutex
+	samples []time.Duration
+	pos     int
+}
+
+type hedgeAttempt struct {
+	endpoint    *pool.Client
+	callContext *proxyCallContext
+	contextID   uint64
+	start       time.Time
+	resp        *http.Response
+	duration    time.Duration
+	err         error
+}
+
+func (tracker *latencyTracker) addSample(duration time.Duration) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	if len(tracker.samples) < hedgeLatencySamples {
+		tracker.samples = append(tracker.samples, duration)
+		return
+	}
+
+	tracker.samples[tracker.pos] = duration
+	tracker.pos = (tracker.pos + 1) % hedgeLatencySamples
+}
+
+func (tracker *latencyTracker) getPercentile(percentile float64) (time.Duration, bool) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	if len(tracker.samples) < hedgeLatencyMinSamples {
+		return 0, false
+	}
+
+	samples := slices.Clone(tracker.samples)
+	slices.Sort(samples)
+
+	idx := int(float64(len(samples)-1) * percentile)
+
+	return samples[idx], true
+}
+
+func (proxy *BeaconProxy) getHedgePathIndex(r *http.Request) int {
+	for idx, hedgePathPattern := range proxy.hedgePaths {
+		if hedgePathPattern.MatchString(r.URL.EscapedPath()) {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+func (proxy *BeaconProxy) isHedgedCall(r *http.Request) bool {
+	if len(proxy.hedgePaths) == 0 {
+		return false
+	}
+
+	// explicitly routed calls must not be sent to a different endpoint
+	if hasNextEndpointOverride(r) {
+		return false
+	}
+
+	return proxy.getHedgePathIndex(r) >= 0
+}
+
+func (proxy *BeaconProxy) getHedgeLatencyTracker(pathIdx int) *latencyTracker {
+	proxy.hedgeMutex.Lock()
+	defer proxy.hedgeMutex.Unlock()
+
+	tracker := proxy.hedgeLatency[pathIdx]
+	if tracker == nil {
+		tracker = &latencyTracker{
+			samples: make([]time.Duration, 0, hedgeLatencySamples),
+		}
+		proxy.hedgeLatency[pathIdx] = tracker
+	}
+
+	return tracker
+}
+
+func (proxy *BeaconProxy) getHedgeDelay(pathIdx int) time.Duration {
+	if proxy.config.HedgePercentile > 0 && proxy.config.HedgePercentile <= 1 {
+		if delay, ok := proxy.getHedgeLatencyTracker(pathIdx).getPercentile(proxy.config.HedgePercentile); ok {
+			return delay
+		}
+	}
+
+	return proxy.config.HedgeDelay
+}
+
+func (proxy *BeaconProxy) getHedgeEndpoint(r *http.Request, session *Session, primary *pool.Client) *pool.Client {
+	candidates := session.group.filterEndpoints(proxy.pool.GetReadyEndpoints(session.prefix, getMinCgcForCall(r)))
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// start at a random offset, so hedged calls are spread over all other endpoints
+	offset := rand.IntN(len(candidates)) //nolint:gosec // no cryptographic randomness needed
+
+	for i := range candidates {
+		candidate := candidates[(offset+i)%len(candidates)]
+		if candidate != primary {
+			return candidate
+		}
+	}
+
+	return nil
+}
+
+func (proxy *BeaconProxy) processHedgedProxyCall(w http.ResponseWriter, r *http.Request, session *Session, endpoint *pool.Client) error {
+	pathIdx := proxy.getHedgePathIndex(r)
+
+	reqBody, apiErr := proxy.readRequestBody(w, r)
+	if apiErr != nil {
+		proxy.writeAPIError(w, apiErr)
+		return nil
+	}
+
+	results := make(chan *hedgeAttempt, 2)
+	attempts := make([]*hedgeAttempt, 0, 2)
+
+	startAttempt := func(endpoint *pool.Client) {
+		attempt := &hedgeAttempt{
+			endpoint:    endpoint,
+			callContext: proxy.newProxyCallContext(r.Context(), proxy.config.CallTimeout),
+			start:       time.Now(),
+		}
+		attempt.contextID = session.addActiveContext(attempt.callContext.cancelFn)
+		attempts = append(attempts, attempt)
+
+		go func() {
+			var body io.ReadCloser = http.NoBody
+			if reqBody != nil {
+				body = io.NopCloser(bytes.NewReader(reqBody))
+			}
+
+			attempt.resp, attempt.err = proxy.sendProxyRequest(attempt.callContext, r, body, int64(len(reqBody)), attempt.endpoint)
+			attempt.duration = time.Since(attempt.start)
+			results <- attempt
+		}()
+	}
+
+	var winner *hedgeAttempt
+
+	defer func() {
+		// release all call contexts after the winning response has been streamed
+		for _, attempt := range attempts {
+			attempt.callContext.cancelFn()
+			session.removeActiveContext(attempt.contextID)
+		}
+	}()
+
+	startAttempt(endpoint)
+
+	hedgeTimer := time.NewTimer(proxy.getHedgeDelay(pathIdx))
+	defer hedgeTimer.Stop()
+
+	pending := 1
+	hedged := false
+	primaryFailed := false
+
+	var lastErr error
+
+	startHedge := func() {
+		if hedged {
+			return
+		}
+
+		hedged = true
+
+		if hedgeEndpoint := proxy.getHedgeEndpoint(r, session, endpoint); hedgeEndpoint != nil {
+			proxy.logger.Debugf("hedging %v %v call to %v (primary: %v)", r.Method, r.URL.EscapedPath(), hedgeEndpoint.GetName(), endpoint.GetName())
+			startAttempt(hedgeEndpoint)
+
+			pending++
+		}
+	}
+
+	for winner == nil && pending > 0 {
+		select {
+		case attempt := <-results:
+			pending--
+
+			if attempt.err != nil {
+				lastErr = attempt.err
+
+				if attempt == attempts[0] {
+					primaryFailed = true
+				}
+
+				// primary failed before the hedge delay passed, send the hedged request right away
+				startHedge()
+
+				continue
+			}
+
+			winner = attempt
+		case <-hedgeTimer.C:
+			startHedge()
+		}
+	}
+
+	if pending > 0 {
+		// drain the losing call in background
+		go func(pending int) {
+			for i := 0; i < pending; i++ {
+				if attempt := <-results; attempt.resp != nil {
+					attempt.resp.Body.Close()
+				}
+			}
+		}(pending)
+	}
+
+	for _, attempt := range attempts {
+		if attempt != winner {
+			attempt.callContext.cancelFn()
+		}
+	}
+
+	if winner == nil {
+		return lastErr
+	}
+
+	latencyTracker := proxy.getHedgeLatencyTracker(pathIdx)
+	latencyTracker.addSample(winner.duration)
+
+	if primary := attempts[0]; winner != primary && !primaryFailed {
+		// the primary was still pending when the hedge won, its elapsed time is a lower bound of its latency.
+		// without this sample the tracker only sees the faster endpoints and the hedge delay keeps shrinking.
+		latencyTracker.addSample(time.Since(primary.start))
+	}
+
+	if proxy.proxyMetrics != nil {
+		proxy.proxyMetrics.AddHedgedCall(fmt.Sprintf("%s%s", r.Method, r.URL.EscapedPath()), hedged, winner.endpoint != endpoint)
+	}
+
+	return proxy.processProxyResponse(w, r, session, winner.endpoint, winner.callContext, winner.resp, winner.duration)
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"net/http"
+	"net/netip"
+
+	"github.com/ethpandaops/dugtrio/types"
+	"github.com/ethpandaops/dugtrio/utils"
+)
+
+// ipFilter holds the compiled IP allow & deny lists.
+type ipFilter struct {
+	allow        []netip.Prefix
+	invalidAllow bool
+	deny         []netip.Prefix
+}
+
+func (proxy *BeaconProxy) compileIPFilter(config *types.IPFilterConfig) *ipFilter {
+	if config == nil {
+		return nil
+	}
+
+	filter := &ipFilter{}
+
+	allowEntries := utils.SplitConfigList(config.Allow, config.AllowStr)
+	filter.allow = proxy.parseIPPrefixes(allowEntries)
+	filter.deny = proxy.parseIPPrefixes(utils.SplitConfigList(config.Deny, config.DenyStr))
+
+	// an invalid entry must not open the proxy to all IPs
+	filter.invalidAllow = len(filter.allow) < len(allowEntries)
+
+	if len(filter.allow) == 0 && len(filter.deny) == 0 && !filter.invalidAllow {
+		return nil
+	}
+
+	return filter
+}
+
+// parseIPPrefixes parses IPs & CIDR ranges, single IPs are converted to single address prefixes.
+func (proxy *BeaconProxy) parseIPPrefixes(entries []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+
+	for _, entry := range entries {
+		prefix, err := utils.ParseIPPrefix(entry)
+		if err != nil {
+			proxy.logger.Errorf("error parsing ip address or range '%v': %v", entry, err)
+			continue
+		}
+
+		prefixes = append(prefixes, prefix)
+	}
+
+	return prefixes
+}
+
+// isAllowed returns true if the IP may use the proxy.
+func (filter *ipFilter) isAllowed(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		// unparsable IPs are only accepted without allow list
+		return len(filter.allow) == 0 && !filter.invalidAllow
+	}
+
+	addr = addr.Unmap()
+
+	for _, prefix := range filter.deny {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	if len(filter.allow) == 0 {
+		return !filter.invalidAllow
+	}
+
+	for _, prefix := range filter.allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkClientIP returns the error response if the client IP is denied or banned, or nil if the call is allowed.
+func (proxy *BeaconProxy) checkClientIP(ip string) *apiErrorResponse {
+	if proxy.ipFilter != nil && !proxy.ipFilter.isAllowed(ip) {
+		return &apiErrorResponse{
+			Code:    http.StatusForbidden,
+			Message: "IP address not allowed",
+		}
+	}
+
+	if ban := proxy.bans.getBan(ip); ban != nil {
+		return &apiErrorResponse{
+			Code:    http.StatusForbidden,
+			Message: "IP address banned",
+		}
+	}
+
+	return nil
+}
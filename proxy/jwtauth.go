@@ -0,0 +1,337 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ethpandaops/dugtrio/types"
+	"github.com/ethpandaops/dugtrio/utils"
+)
+
+const jwksReloadInterval = 10 * time.Second
+
+// jwtValidator validates bearer tokens against the configured HMAC secrets and the keys of a local JWKS file.
+type jwtValidator struct {
+	logger   *logrus.Entry
+	config   *types.JWTConfig
+	parser   *jwt.Parser
+	hmacKeys []jwt.VerificationKey
+	profiles map[string]*authProfile
+
+	jwksMutex   sync.RWMutex
+	jwksKeys    []*jwksKey
+	jwksModTime time.Time
+	jwksSize    int64
+}
+
+type jwksKey struct {
+	kid string
+	key jwt.VerificationKey
+}
+
+type jwksFile struct {
+	Keys []*jwksEntry `json:"keys"`
+}
+
+type jwksEntry struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// newJWTValidator returns the bearer token validator, or nil if neither HMAC secrets nor a JWKS file are configured.
+func (proxy *BeaconProxy) newJWTValidator(config *types.JWTConfig) *jwtValidator {
+	if config == nil {
+		return nil
+	}
+
+	validator := &jwtValidator{
+		logger: logrus.WithField("module", "jwtauth"),
+		config: config,
+	}
+
+	for _, secret := range config.HMACSecrets {
+		validator.hmacKeys = append(validator.hmacKeys, []byte(secret))
+	}
+
+	for _, secret := range strings.Split(config.HMACSecretsStr, ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			validator.hmacKeys = append(validator.hmacKeys, []byte(secret))
+		}
+	}
+
+	if len(validator.hmacKeys) == 0 && config.JWKSFile == "" {
+		return nil
+	}
+
+	validMethods := []string{}
+	if len(validator.hmacKeys) > 0 {
+		validMethods = append(validMethods, "HS256", "HS384", "HS512")
+	}
+
+	if config.JWKSFile != "" {
+		validMethods = append(validMethods, "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA")
+
+		err := validator.loadJWKS()
+		if err != nil {
+			validator.logger.Errorf("error loading jwks file: %v", err)
+		}
+
+		go validator.runJWKSReloadLoop()
+	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods(validMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(config.Leeway),
+	}
+
+	if config.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(config.Issuer))
+	}
+
+	if config.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(config.Audience))
+	}
+
+	validator.parser = jwt.NewParser(parserOpts...)
+
+	if config.IdentityClaim == "" {
+		config.IdentityClaim = "sub"
+	}
+
+	validator.profiles = proxy.compileAuthProfiles(config.Profiles)
+
+	return validator
+}
+
+// validateToken validates the token and returns the identity it belongs to.
+func (validator *jwtValidator) validateToken(tokenStr string) (*AuthIdentity, error) {
+	claims := jwt.MapClaims{}
+
+	_, err := validator.parser.ParseWithClaims(tokenStr, claims, validator.getVerificationKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	name, ok := claims[validator.config.IdentityClaim].(string)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("missing identity claim '%v'", validator.config.IdentityClaim)
+	}
+
+	identity := &AuthIdentity{
+		Name: name,
+		Type: AuthTypeJWT,
+	}
+
+	profileName := validator.config.DefaultProfile
+
+	if validator.config.ProfileClaim != "" {
+		if claimValue, ok := claims[validator.config.ProfileClaim].(string); ok && claimValue != "" {
+			profileName = claimValue
+		}
+	}
+
+	if profileName != "" {
+		profile := validator.profiles[profileName]
+		if profile == nil {
+			return nil, fmt.Errorf("unknown profile '%v'", profileName)
+		}
+
+		identity.rateTier = &profile.config.RateTierConfig
+		identity.acl = profile.acl
+	}
+
+	return identity, nil
+}
+
+func (validator *jwtValidator) getVerificationKeys(token *jwt.Token) (any, error) {
+	if _, isHMAC := token.Method.(*jwt.SigningMethodHMAC); isHMAC {
+		return jwt.VerificationKeySet{Keys: validator.hmacKeys}, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	validator.jwksMutex.RLock()
+	defer validator.jwksMutex.RUnlock()
+
+	keys := []jwt.VerificationKey{}
+
+	for _, key := range validator.jwksKeys {
+		if kid == "" || key.kid == kid {
+			keys = append(keys, key.key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no matching key found (kid: %v)", kid)
+	}
+
+	return jwt.VerificationKeySet{Keys: keys}, nil
+}
+
+func (validator *jwtValidator) runJWKSReloadLoop() {
+	defer utils.HandleSubroutinePanic("proxy.jwtauth.reload", validator.runJWKSReloadLoop)
+
+	for {
+		time.Sleep(jwksReloadInterval)
+
+		err := validator.loadJWKS()
+		if err != nil {
+			validator.logger.Warnf("error reloading jwks file: %v", err)
+		}
+	}
+}
+
+// loadJWKS loads the keys of the JWKS file if it has been changed since it was loaded the last time.
+// The previously loaded keys are kept if the file cannot be loaded.
+func (validator *jwtValidator) loadJWKS() error {
+	fileInfo, err := os.Stat(validator.config.JWKSFile)
+	if err != nil {
+		return err
+	}
+
+	validator.jwksMutex.RLock()
+	unchanged := fileInfo.ModTime().Equal(validator.jwksModTime) && fileInfo.Size() == validator.jwksSize
+	validator.jwksMutex.RUnlock()
+
+	if unchanged {
+		return nil
+	}
+
+	data, err := os.ReadFile(validator.config.JWKSFile)
+	if err != nil {
+		return err
+	}
+
+	jwks := &jwksFile{}
+
+	err = json.Unmarshal(data, jwks)
+	if err != nil {
+		return fmt.Errorf("error parsing jwks file: %w", err)
+	}
+
+	keys := make([]*jwksKey, 0, len(jwks.Keys))
+
+	for idx, entry := range jwks.Keys {
+		if entry.Use != "" && entry.Use != "sig" {
+			continue
+		}
+
+		key, err := entry.getPublicKey()
+		if err != nil {
+			validator.logger.Warnf("error parsing jwks key %v (kid: %v): %v", idx, entry.Kid, err)
+			continue
+		}
+
+		keys = append(keys, &jwksKey{
+			kid: entry.Kid,
+			key: key,
+		})
+	}
+
+	validator.jwksMutex.Lock()
+	validator.jwksKeys = keys
+	validator.jwksModTime = fileInfo.ModTime()
+	validator.jwksSize = fileInfo.Size()
+	validator.jwksMutex.Unlock()
+
+	validator.logger.Infof("loaded %v keys from jwks file", len(keys))
+
+	return nil
+}
+
+func (entry *jwksEntry) getPublicKey() (jwt.VerificationKey, error) {
+	switch entry.Kty {
+	case "RSA":
+		n, err := decodeJWKSBigInt(entry.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+
+		e, err := decodeJWKSBigInt(entry.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+
+		switch entry.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve '%v'", entry.Crv)
+		}
+
+		x, errX := base64.RawURLEncoding.DecodeString(entry.X)
+		y, errY := base64.RawURLEncoding.DecodeString(entry.Y)
+
+		if err := errors.Join(errX, errY); err != nil {
+			return nil, fmt.Errorf("invalid coordinates: %w", err)
+		}
+
+		// uncompressed point encoding: 0x04 | x | y
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) > size || len(y) > size {
+			return nil, fmt.Errorf("invalid coordinates")
+		}
+
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		copy(point[1+size-len(x):1+size], x)
+		copy(point[1+2*size-len(y):], y)
+
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	case "OKP":
+		if entry.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve '%v'", entry.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(entry.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid public key")
+		}
+
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type '%v'", entry.Kty)
+	}
+}
+
+func decodeJWKSBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
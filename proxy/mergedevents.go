@@ -0,0 +1,368 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ethpandaops/dugtrio/pool"
+	"github.com/ethpandaops/dugtrio/rpc"
+	"github.com/ethpandaops/dugtrio/utils"
+)
+
+const (
+	mergedEventsPath       = "/dugtrio/events"
+	mergedEventsBuffer     = 256
+	mergedEventsArrivals   = 1024
+	mergedEventsLateTopic  = "late_arrival"
+	mergedEventsSyncPeriod = 5 * time.Second
+)
+
+var mergedEventTopics = map[string]bool{
+	"block":                true,
+	"head":                 true,
+	"finalized_checkpoint": true,
+}
+
+// mergedEventStream subscribes to block, head and finalized_checkpoint events on all ready endpoints and forwards
+// each event the first time any endpoint reports it. Later reports of the same event are forwarded as late arrivals.
+type mergedEventStream struct {
+	proxy  *BeaconProxy
+	logger *logrus.Entry
+
+	mutex        sync.Mutex
+	cancelFn     context.CancelFunc
+	subscribers  map[uint64]*mergedEventSubscriber
+	nextID       uint64
+	arrivals     map[string]*mergedEventArrival
+	arrivalOrder []string
+	arrivalPos   int
+}
+
+type mergedEventSubscriber struct {
+	id        uint64
+	topics    map[string]bool
+	events    chan []byte
+	closeChan chan struct{}
+	closeOnce sync.Once
+}
+
+type mergedEventArrival struct {
+	firstNode string
+	firstSeen time.Time
+	nodes     map[string]bool
+}
+
+type mergedEventPayload struct {
+	Node     string          `json:"node"`
+	Received int64           `json:"received"`
+	Data     json.RawMessage `json:"data"`
+}
+
+type mergedEventLatePayload struct {
+	Event     string `json:"event"`
+	Root      string `json:"root"`
+	Node      string `json:"node"`
+	FirstNode string `json:"first_node"`
+	Delay     int64  `json:"delay_ms"`
+}
+
+func newMergedEventStream(proxy *BeaconProxy) *mergedEventStream {
+	return &mergedEventStream{
+		proxy:       proxy,
+		logger:      logrus.WithField("module", "mergedevents"),
+		subscribers: make(map[uint64]*mergedEventSubscriber),
+		arrivals:    make(map[string]*mergedEventArrival),
+	}
+}
+
+func isMergedEventStreamRequest(r *http.Request) bool {
+	return r.URL.Path == mergedEventsPath
+}
+
+// serve forwards the merged events of the requested topics until the client disconnects.
+func (merged *mergedEventStream) serve(w http.ResponseWriter, r *http.Request, session *Session) {
+	topics := map[string]bool{}
+
+	for _, topic := range getEventStreamTopics(r) {
+		if !mergedEventTopics[topic] {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusBadRequest)
+
+			_, err := w.Write([]byte(fmt.Sprintf("Unsupported event topic: %v", topic)))
+			if err != nil {
+				merged.logger.Warnf("error writing bad request response: %v", err)
+			}
+
+			return
+		}
+
+		topics[topic] = true
+	}
+
+	if len(topics) == 0 {
+		topics = mergedEventTopics
+	}
+
+	subscriber := merged.subscribe(topics)
+	defer merged.unsubscribe(subscriber)
+
+	respH := w.Header()
+	respH.Set("X-Dugtrio-Version", fmt.Sprintf("dugtrio/%v", utils.GetVersion()))
+	respH.Set("X-Dugtrio-Session-Ip", session.group.GetIPAddr())
+	respH.Set("Content-Type", "text/event-stream")
+	respH.Set("Cache-Control", "no-cache")
+	respH.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	for {
+		select {
+		case data := <-subscriber.events:
+			_, err := w.Write(data)
+			if err != nil {
+				return
+			}
+
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+
+			now := time.Now()
+			session.group.lastSeen = now
+			session.lastSeen = now
+		case <-subscriber.closeChan:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (merged *mergedEventStream) subscribe(topics map[string]bool) *mergedEventSubscriber {
+	merged.mutex.Lock()
+	defer merged.mutex.Unlock()
+
+	subscriber := &mergedEventSubscriber{
+		id:        merged.nextID,
+		topics:    topics,
+		events:    make(chan []byte, mergedEventsBuffer),
+		closeChan: make(chan struct{}),
+	}
+	merged.nextID++
+	merged.subscribers[subscriber.id] = subscriber
+
+	if merged.cancelFn == nil {
+		// first subscriber, start the upstream subscriptions
+		ctx, cancelFn := context.WithCancel(context.Background())
+		merged.cancelFn = cancelFn
+
+		go merged.run(ctx)
+	}
+
+	return subscriber
+}
+
+func (merged *mergedEventStream) unsubscribe(subscriber *mergedEventSubscriber) {
+	merged.mutex.Lock()
+	defer merged.mutex.Unlock()
+
+	delete(merged.subscribers, subscriber.id)
+	subscriber.close()
+
+	if len(merged.subscribers) == 0 && merged.cancelFn != nil {
+		// last subscriber left, close the upstream subscriptions
+		merged.cancelFn()
+		merged.cancelFn = nil
+	}
+}
+
+func (subscriber *mergedEventSubscriber) close() {
+	subscriber.closeOnce.Do(func() {
+		close(subscriber.closeChan)
+	})
+}
+
+// run keeps one event stream open on each ready endpoint until the context is cancelled.
+func (merged *mergedEventStream) run(ctx context.Context) {
+	defer utils.HandleSubroutinePanic("proxy.mergedevents.run", nil)
+
+	clientStreams := map[*pool.Client]context.CancelFunc{}
+
+	defer func() {
+		for _, cancelFn := range clientStreams {
+			cancelFn()
+		}
+	}()
+
+	ticker := time.NewTicker(mergedEventsSyncPeriod)
+	defer ticker.Stop()
+
+	for {
+		readyClients := map[*pool.Client]bool{}
+
+		for _, client := range merged.proxy.pool.GetReadyEndpoints(pool.UnspecifiedClient, 0) {
+			readyClients[client] = true
+
+			if clientStreams[client] == nil {
+				clientCtx, cancelFn := context.WithCancel(ctx)
+				clientStreams[client] = cancelFn
+
+				go merged.runClientStream(clientCtx, client)
+			}
+		}
+
+		for client, cancelFn := range clientStreams {
+			if !readyClients[client] {
+				cancelFn()
+				delete(clientStreams, client)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (merged *mergedEventStream) runClientStream(ctx context.Context, client *pool.Client) {
+	defer utils.HandleSubroutinePanic("proxy.mergedevents.client", nil)
+
+	stream := client.NewEventStream(rpc.StreamBlockEvent | rpc.StreamHeadEvent | rpc.StreamFinalizedEvent)
+
+	// keep draining the stream channels until it is closed, the stream blocks on full channels otherwise
+	closedChan := make(chan struct{})
+
+	go func() {
+		<-ctx.Done()
+		stream.Close()
+		close(closedChan)
+	}()
+
+	for {
+		select {
+		case evt := <-stream.EventChan:
+			if ctx.Err() == nil {
+				merged.processEvent(client, evt, time.Now())
+			}
+		case <-stream.ReadyChan:
+		case <-closedChan:
+			return
+		}
+	}
+}
+
+func (merged *mergedEventStream) processEvent(client *pool.Client, evt *rpc.BeaconStreamEvent, received time.Time) {
+	var topic, key, root string
+
+	switch data := evt.Data.(type) {
+	case *v1.BlockEvent:
+		topic = "block"
+		root = data.Block.String()
+		key = fmt.Sprintf("%v:%v:%v", topic, data.Slot, root)
+	case *v1.HeadEvent:
+		topic = "head"
+		root = data.Block.String()
+		key = fmt.Sprintf("%v:%v:%v", topic, data.Slot, root)
+	case *v1.FinalizedCheckpointEvent:
+		topic = "finalized_checkpoint"
+		root = data.Block.String()
+		key = fmt.Sprintf("%v:%v:%v", topic, data.Epoch, root)
+	default:
+		return
+	}
+
+	merged.mutex.Lock()
+	defer merged.mutex.Unlock()
+
+	arrival := merged.arrivals[key]
+	if arrival == nil {
+		eventData, err := json.Marshal(evt.Data)
+		if err != nil {
+			merged.logger.Warnf("error encoding %v event: %v", topic, err)
+			return
+		}
+
+		merged.addArrival(key, &mergedEventArrival{
+			firstNode: client.GetName(),
+			firstSeen: received,
+			nodes: map[string]bool{
+				client.GetName(): true,
+			},
+		})
+
+		merged.broadcast(topic, topic, &mergedEventPayload{
+			Node:     client.GetName(),
+			Received: received.UnixMilli(),
+			Data:     eventData,
+		})
+
+		return
+	}
+
+	if arrival.nodes[client.GetName()] {
+		return
+	}
+
+	arrival.nodes[client.GetName()] = true
+
+	merged.broadcast(topic, mergedEventsLateTopic, &mergedEventLatePayload{
+		Event:     topic,
+		Root:      root,
+		Node:      client.GetName(),
+		FirstNode: arrival.firstNode,
+		Delay:     received.Sub(arrival.firstSeen).Milliseconds(),
+	})
+}
+
+// addArrival remembers the arrival of an event, the oldest arrival is forgotten when the limit is reached.
+func (merged *mergedEventStream) addArrival(key string, arrival *mergedEventArrival) {
+	if len(merged.arrivalOrder) < mergedEventsArrivals {
+		merged.arrivalOrder = append(merged.arrivalOrder, key)
+	} else {
+		delete(merged.arrivals, merged.arrivalOrder[merged.arrivalPos])
+		merged.arrivalOrder[merged.arrivalPos] = key
+		merged.arrivalPos = (merged.arrivalPos + 1) % mergedEventsArrivals
+	}
+
+	merged.arrivals[key] = arrival
+}
+
+// broadcast sends the event to all subscribers of the topic. Subscribers with a full buffer get disconnected.
+func (merged *mergedEventStream) broadcast(topic, event string, payload any) {
+	payloadData, err := json.Marshal(payload)
+	if err != nil {
+		merged.logger.Warnf("error encoding %v event: %v", event, err)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "event: %v\ndata: %s\n\n", event, payloadData)
+	data := buf.Bytes()
+
+	for id, subscriber := range merged.subscribers {
+		if !subscriber.topics[topic] {
+			continue
+		}
+
+		select {
+		case subscriber.events <- data:
+		default:
+			merged.logger.Infof("dropping slow merged event stream subscriber")
+			delete(merged.subscribers, id)
+			subscriber.close()
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/ethpandaops/dugtrio/pool"
+	"github.com/ethpandaops/dugtrio/utils"
+)
+
+// startMirrorCalls sends a copy of sampled GET calls to all ready mirror endpoints in the background.
+// The mirror responses are discarded, only their latency and status are recorded.
+func (proxy *BeaconProxy) startMirrorCalls(r *http.Request) {
+	if r.Method != http.MethodGet || isEventStreamRequest(r) || isMergedEventStreamRequest(r) {
+		return
+	}
+
+	endpoints := proxy.pool.GetMirrorEndpoints()
+	if len(endpoints) == 0 || rand.Float64() >= *proxy.config.MirrorSampleRate {
+		return
+	}
+
+	// the mirror calls might outlive the client request, so they need their own request copy
+	request := r.Clone(context.Background())
+
+	for _, endpoint := range endpoints {
+		select {
+		case proxy.mirrorSlots <- struct{}{}:
+			go proxy.sendMirrorCall(request, endpoint)
+		default:
+			// too many mirror calls in flight, drop the sample instead of piling up goroutines
+			if proxy.proxyMetrics != nil {
+				proxy.proxyMetrics.AddMirrorDropped(endpoint.GetName())
+			}
+		}
+	}
+}
+
+func (proxy *BeaconProxy) sendMirrorCall(r *http.Request, endpoint *pool.Client) {
+	defer utils.HandleSubroutinePanic("proxy.mirror", nil)
+
+	defer func() {
+		<-proxy.mirrorSlots
+	}()
+
+	callContext := proxy.newProxyCallContext(context.Background(), proxy.config.CallTimeout)
+	defer callContext.cancelFn()
+
+	start := time.Now()
+	status := 0
+
+	resp, err := proxy.sendProxyRequest(callContext, r, http.NoBody, 0, endpoint)
+	if err == nil {
+		status = resp.StatusCode
+		_, err = io.Copy(io.Discard, resp.Body)
+
+		resp.Body.Close()
+	}
+
+	if err != nil {
+		proxy.logger.WithField("endpoint", endpoint.GetName()).Debugf("mirror call %v failed: %v", r.URL.EscapedPath(), err)
+	}
+
+	if proxy.proxyMetrics != nil {
+		proxy.proxyMetrics.AddMirrorCall(endpoint.GetName(), fmt.Sprintf("%s%s", r.Method, r.URL.EscapedPath()), time.Since(start), status)
+	}
+}
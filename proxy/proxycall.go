@@ -7,7 +7,6 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"strings"
 	"time"
 
 	"github.com/ethpandaops/dugtrio/pool"
@@ -60,6 +59,10 @@ ctxLoop:
 }
 
 func (proxy *BeaconProxy) processProxyCall(w http.ResponseWriter, r *http.Request, session *Session, endpoint *pool.Client) error {
+	if proxy.isHedgedCall(r) {
+		return proxy.processHedgedProxyCall(w, r, session, endpoint)
+	}
+
 	callContext := proxy.newProxyCallContext(r.Context(), proxy.config.CallTimeout)
 	contextID := session.addActiveContext(callContext.cancelFn)
 
@@ -68,6 +71,17 @@ func (proxy *BeaconProxy) processProxyCall(w http.ResponseWriter, r *http.Reques
 		session.removeActiveContext(contextID)
 	}()
 
+	start := time.Now()
+
+	resp, err := proxy.sendProxyRequest(callContext, r, r.Body, r.ContentLength, endpoint)
+	if err != nil {
+		return err
+	}
+
+	return proxy.processProxyResponse(w, r, session, endpoint, callContext, resp, time.Since(start))
+}
+
+func (proxy *BeaconProxy) sendProxyRequest(callContext *proxyCallContext, r *http.Request, body io.ReadCloser, contentLength int64, endpoint *pool.Client) (*http.Response, error) {
 	endpointConfig := endpoint.GetEndpointConfig()
 
 	// get filtered headers
@@ -83,13 +97,7 @@ func (proxy *BeaconProxy) processProxyCall(w http.ResponseWriter, r *http.Reques
 		hh.Add(hk, hv)
 	}
 
-	proxyIPChain := []string{}
-	if forwaredFor := r.Header.Get("X-Forwarded-For"); forwaredFor != "" {
-		proxyIPChain = strings.Split(forwaredFor, ", ")
-	}
-
-	proxyIPChain = append(proxyIPChain, r.RemoteAddr)
-	hh.Set("X-Forwarded-For", strings.Join(proxyIPChain, ", "))
+	proxy.setForwardingHeaders(hh, r)
 
 	// build proxy url
 	queryArgs := ""
@@ -99,7 +107,7 @@ func (proxy *BeaconProxy) processProxyCall(w http.ResponseWriter, r *http.Reques
 
 	proxyURL, err := url.Parse(fmt.Sprintf("%s%s%s", endpointConfig.URL, r.URL.EscapedPath(), queryArgs))
 	if err != nil {
-		return fmt.Errorf("error parsing proxy url: %w", err)
+		return nil, fmt.Errorf("error parsing proxy url: %w", err)
 	}
 
 	// construct request to send to origin server
@@ -107,34 +115,36 @@ func (proxy *BeaconProxy) processProxyCall(w http.ResponseWriter, r *http.Reques
 		Method:        r.Method,
 		URL:           proxyURL,
 		Header:        hh,
-		Body:          r.Body,
-		ContentLength: r.ContentLength,
+		Body:          body,
+		ContentLength: contentLength,
 		Close:         r.Close,
 	}
-	start := time.Now()
-	client := &http.Client{Timeout: 0}
+	client := endpoint.GetHTTPClient()
 	req = req.WithContext(callContext.context)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("proxy request error: %w", err)
+		return nil, fmt.Errorf("proxy request error: %w", err)
 	}
 
 	if callContext.cancelled {
 		resp.Body.Close()
-		return fmt.Errorf("proxy context cancelled")
+		return nil, fmt.Errorf("proxy context cancelled")
 	}
 
 	callContext.streamReader = resp.Body
 
+	return resp, nil
+}
+
+func (proxy *BeaconProxy) processProxyResponse(w http.ResponseWriter, r *http.Request, session *Session, endpoint *pool.Client, callContext *proxyCallContext, resp *http.Response, callDuration time.Duration) error {
 	// add to stats
 	if proxy.proxyMetrics != nil {
-		callDuration := time.Since(start)
 		proxy.proxyMetrics.AddCall(endpoint.GetName(), fmt.Sprintf("%s%s", r.Method, r.URL.EscapedPath()), callDuration, resp.StatusCode)
 	}
 
 	respContentType := resp.Header.Get("Content-Type")
-	isEventStream := respContentType == "text/event-stream" || strings.HasPrefix(r.URL.EscapedPath(), "/eth/v1/events")
+	isEventStream := respContentType == "text/event-stream" || isEventStreamRequest(r)
 
 	// passthru response headers
 	respH := w.Header()
@@ -147,7 +157,6 @@ func (proxy *BeaconProxy) processProxyCall(w http.ResponseWriter, r *http.Reques
 
 	respH.Set("X-Dugtrio-Version", fmt.Sprintf("dugtrio/%v", utils.GetVersion()))
 	respH.Set("X-Dugtrio-Session-Ip", session.group.GetIPAddr())
-	respH.Set("X-Dugtrio-Session-Tokens", fmt.Sprintf("%.2f", session.group.getCallLimitTokens()))
 	respH.Set("X-Dugtrio-Endpoint-Name", endpoint.GetName())
 	respH.Set("X-Dugtrio-Endpoint-Type", endpoint.GetClientType().String())
 	respH.Set("X-Dugtrio-Endpoint-Version", endpoint.GetVersion())
@@ -167,7 +176,7 @@ func (proxy *BeaconProxy) processProxyCall(w http.ResponseWriter, r *http.Reques
 			f.Flush()
 		}
 
-		rspLen, err := proxy.processEventStreamResponse(callContext, w, resp.Body, session)
+		rspLen, err := proxy.processEventStreamResponse(callContext, w, r, resp.Body, session, endpoint, resp.StatusCode == http.StatusOK)
 		if err != nil {
 			proxy.logger.Warnf("proxy event stream error: %v", err)
 		}
@@ -188,29 +197,146 @@ func (proxy *BeaconProxy) processProxyCall(w http.ResponseWriter, r *http.Reques
 	return nil
 }
 
-func (proxy *BeaconProxy) processEventStreamResponse(callContext *proxyCallContext, w http.ResponseWriter, r io.ReadCloser, session *Session) (int64, error) {
+// processEventStreamResponse forwards the upstream event stream to the client. With failover enabled, the stream gets
+// resubscribed on another ready endpoint when the upstream stream ends while the client is still connected.
+func (proxy *BeaconProxy) processEventStreamResponse(callContext *proxyCallContext, w http.ResponseWriter, r *http.Request, body io.ReadCloser, session *Session, endpoint *pool.Client, failover bool) (int64, error) {
+	dedup := newEventDeduplicator()
+	written := int64(0)
+
+	defer func() {
+		callContext.cancelFn()
+	}()
+
+	replayed := map[uint64]bool{}
+
+	// only successful upstream streams record events for replay
+	topics := getEventStreamTopics(r)
+	recording := false
+	setRecording := func(active bool) {
+		if proxy.eventReplay == nil || !failover || recording == active {
+			return
+		}
+
+		recording = active
+
+		if active {
+			proxy.eventReplay.startRecording(topics)
+		} else {
+			proxy.eventReplay.stopRecording(topics)
+		}
+	}
+
+	setRecording(true)
+	defer setRecording(false)
+
+	// the context of the initial upstream call is released by the caller, only resubscribed calls are tracked here
+	failoverContextID := uint64(0)
+	hasFailoverContext := false
+
+	defer func() {
+		if hasFailoverContext {
+			session.removeActiveContext(failoverContextID)
+		}
+	}()
+
+	if failover {
+		// replay missed events to reconnecting clients before forwarding the live stream
+		replayedIDs, rspLen, err := proxy.replayEvents(w, r)
+		if err != nil {
+			return rspLen, err
+		}
+
+		replayed = replayedIDs
+		written += rspLen
+	}
+
+	for {
+		stopWatcher := proxy.watchEndpointReadiness(callContext, endpoint)
+		rspLen, err := proxy.forwardEventStream(callContext, w, body, session, dedup, replayed)
+		stopWatcher()
+		setRecording(false)
+
+		written += rspLen
+
+		if !failover || r.Context().Err() != nil {
+			return written, err
+		}
+
+		callContext.cancelFn()
+
+		proxy.logger.WithField("endpoint", endpoint.GetName()).Debugf("upstream event stream ended (ip: %v): %v", session.group.GetIPAddr(), err)
+
+		nextEndpoint, nextCallContext, contextID, nextBody := proxy.resubscribeEventStream(r, session)
+		if nextEndpoint == nil {
+			return written, err
+		}
+
+		// release the context of the replaced upstream call right away, not when the client stream ends
+		if hasFailoverContext {
+			session.removeActiveContext(failoverContextID)
+		}
+
+		failoverContextID = contextID
+		hasFailoverContext = true
+
+		setRecording(true)
+
+		proxy.logger.Infof("switched event stream upstream (ip: %v): %v -> %v", session.group.GetIPAddr(), endpoint.GetName(), nextEndpoint.GetName())
+
+		if proxy.proxyMetrics != nil {
+			proxy.proxyMetrics.AddEventStreamFailover(endpoint.GetName(), nextEndpoint.GetName())
+		}
+
+		wb, err := w.Write(formatEventStreamSwitchComment(endpoint, nextEndpoint))
+		if err != nil {
+			nextCallContext.cancelFn()
+			return written, err
+		}
+
+		written += int64(wb)
+
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		endpoint = nextEndpoint
+		callContext = nextCallContext
+		body = nextBody
+	}
+}
+
+func (proxy *BeaconProxy) forwardEventStream(callContext *proxyCallContext, w http.ResponseWriter, r io.ReadCloser, session *Session, dedup *eventDeduplicator, replayed map[uint64]bool) (int64, error) {
 	rd := bufio.NewReaderSize(r, 64*1024)
 	written := int64(0)
 
 	for {
-		for {
-			evt, err := rd.ReadSlice('\n')
-			if err != nil {
-				return written, err
-			}
+		evt, err := readSSEEvent(rd)
+		if err != nil {
+			return written, err
+		}
 
-			wb, err := w.Write(evt)
-			if err != nil {
-				return written, err
-			}
+		if dedup.isDuplicate(evt) {
+			continue
+		}
 
-			written += int64(wb)
+		data := evt.raw
 
-			if wb == 1 || (wb == 2 && evt[0] == '\r') {
-				break
+		if proxy.eventReplay != nil {
+			eventID, eventData := proxy.eventReplay.record(evt)
+			if replayed[eventID] {
+				continue
 			}
+
+			data = eventData
 		}
 
+		wb, err := w.Write(data)
+		if err != nil {
+			return written, err
+		}
+
+		written += int64(wb)
+
 		if f, ok := w.(http.Flusher); ok {
 			f.Flush()
 		}
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ethpandaops/dugtrio/utils"
+)
+
+// quotaStore counts the requests per identity for daily and monthly quotas (UTC periods).
+// The counters are persisted to a local file, so they survive restarts.
+type quotaStore struct {
+	logger       *logrus.Entry
+	path         string
+	persistMutex sync.Mutex
+	mutex        sync.Mutex
+	dirty        bool
+	counters     map[string]*quotaCounter
+}
+
+type quotaCounter struct {
+	Day        string    `json:"day"`
+	DayCount   uint64    `json:"day_count"`
+	Month      string    `json:"month"`
+	MonthCount uint64    `json:"month_count"`
+	LastUsed   time.Time `json:"last_used"`
+}
+
+func newQuotaStore(path string) *quotaStore {
+	store := &quotaStore{
+		logger:   logrus.WithField("module", "quota"),
+		path:     path,
+		counters: map[string]*quotaCounter{},
+	}
+
+	if path != "" {
+		err := store.load()
+		if err != nil {
+			store.logger.Warnf("error loading quota state: %v", err)
+		}
+
+		go store.runPersistLoop()
+	}
+
+	return store
+}
+
+func (store *quotaStore) load() error {
+	data, err := os.ReadFile(store.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(data, &store.counters)
+	if err != nil {
+		return err
+	}
+
+	// counters persisted by older versions have no last used time
+	now := time.Now().UTC()
+	for _, counter := range store.counters {
+		if counter.LastUsed.IsZero() {
+			counter.LastUsed = now
+		}
+	}
+
+	return nil
+}
+
+func (store *quotaStore) runPersistLoop() {
+	defer utils.HandleSubroutinePanic("proxy.quota.persist", store.runPersistLoop)
+
+	for {
+		time.Sleep(10 * time.Second)
+
+		err := store.persist()
+		if err != nil {
+			store.logger.Warnf("error persisting quota state: %v", err)
+		}
+	}
+}
+
+func (store *quotaStore) persist() error {
+	// serializes the background loop and the shutdown, so an older snapshot never overwrites a newer one
+	store.persistMutex.Lock()
+	defer store.persistMutex.Unlock()
+
+	store.mutex.Lock()
+
+	if !store.dirty {
+		store.mutex.Unlock()
+		return nil
+	}
+
+	// drop counters of past months
+	month := time.Now().UTC().Format("2006-01")
+	for key, counter := range store.counters {
+		if counter.Month != month {
+			delete(store.counters, key)
+		}
+	}
+
+	data, err := json.Marshal(store.counters)
+	store.dirty = false
+	store.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(store.path, data)
+}
+
+// expire drops the counters with the key prefix that have not been used within the timeout.
+func (store *quotaStore) expire(keyPrefix string, timeout time.Duration) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for key, counter := range store.counters {
+		if strings.HasPrefix(key, keyPrefix) && time.Since(counter.LastUsed) > timeout {
+			delete(store.counters, key)
+			store.dirty = true
+		}
+	}
+}
+
+// shutdown persists the counters that have not been persisted yet.
+func (store *quotaStore) shutdown() {
+	if store.path == "" {
+		return
+	}
+
+	err := store.persist()
+	if err != nil {
+		store.logger.Warnf("error persisting quota state: %v", err)
+	}
+}
+
+// consume counts a request against the quotas of the key. Returns an error with the time the quota resets if a quota is exhausted.
+func (store *quotaStore) consume(key string, dailyQuota, monthlyQuota uint64) (time.Time, error) {
+	now := time.Now().UTC()
+	day := now.Format("2006-01-02")
+	month := now.Format("2006-01")
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	counter := store.counters[key]
+	if counter == nil {
+		counter = &quotaCounter{}
+		store.counters[key] = counter
+	}
+
+	if counter.Day != day {
+		counter.Day = day
+		counter.DayCount = 0
+	}
+
+	if counter.Month != month {
+		counter.Month = month
+		counter.MonthCount = 0
+	}
+
+	if monthlyQuota > 0 && counter.MonthCount >= monthlyQuota {
+		return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC), fmt.Errorf("monthly request quota exceeded")
+	}
+
+	if dailyQuota > 0 && counter.DayCount >= dailyQuota {
+		return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC), fmt.Errorf("daily request quota exceeded")
+	}
+
+	counter.DayCount++
+	counter.MonthCount++
+	counter.LastUsed = now
+	store.dirty = true
+
+	return time.Time{}, nil
+}
@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/ethpandaops/dugtrio/types"
+)
+
+// rateTier holds the concurrency and quota limits of an identity. Authenticated identities share one tier across
+// all their session groups, unauthenticated session groups get their own tier.
+type rateTier struct {
+	config   *types.RateTierConfig
+	limiter  *rate.Limiter
+	active   atomic.Int64
+	quotaKey string
+}
+
+// getRateTier returns the rate tier for a new rate limit key.
+func (proxy *BeaconProxy) getRateTier(identity *AuthIdentity, limitsKey string) *rateTier {
+	if identity != nil && identity.rateTier != nil {
+		proxy.rateTierMutex.Lock()
+		defer proxy.rateTierMutex.Unlock()
+
+		tierKey := identity.getKey()
+
+		tier := proxy.rateTiers[tierKey]
+		if tier == nil {
+			tier = &rateTier{
+				config:   identity.rateTier,
+				quotaKey: tierKey,
+			}
+
+			if identity.Type == AuthTypeApiKey {
+				// keep the quota key of persisted api key quotas
+				tier.quotaKey = fmt.Sprintf("key:%v", identity.Name)
+			}
+
+			if tier.config.RateLimit > 0 {
+				// the rate limit is shared by all sessions of the identity
+				tier.limiter = rate.NewLimiter(rate.Limit(tier.config.RateLimit), proxy.getRateBurst(tier.config))
+			}
+
+			proxy.rateTiers[tierKey] = tier
+		}
+
+		return tier
+	}
+
+	tier := &rateTier{
+		config: &types.RateTierConfig{},
+	}
+
+	if identity == nil && proxy.config.Auth != nil && proxy.config.Auth.Unauthenticated != nil {
+		tier.config = proxy.config.Auth.Unauthenticated
+		tier.quotaKey = fmt.Sprintf("ip:%v", limitsKey)
+	}
+
+	return tier
+}
+
+func (proxy *BeaconProxy) getRateBurst(config *types.RateTierConfig) int {
+	if config.RateBurst > 0 {
+		return config.RateBurst
+	}
+
+	if config.RateLimit > 0 {
+		return int(config.RateLimit) //nolint:gosec // no overflow
+	}
+
+	return proxy.config.CallRateBurst
+}
+
+// newGroupLimiter returns the rate limiter for a new rate limit key: the shared limiter of the tier,
+// a per-group limiter with the tier rate, or a per-group limiter with the global rate.
+func (proxy *BeaconProxy) newGroupLimiter(tier *rateTier) *rate.Limiter {
+	if tier.limiter != nil {
+		return tier.limiter
+	}
+
+	if tier.config.RateLimit > 0 {
+		return rate.NewLimiter(rate.Limit(tier.config.RateLimit), proxy.getRateBurst(tier.config))
+	}
+
+	if proxy.config.CallRateLimit > 0 {
+		return rate.NewLimiter(rate.Limit(proxy.config.CallRateLimit), proxy.config.CallRateBurst)
+	}
+
+	return nil
+}
+
+// acquireConcurrency reserves a concurrent request slot of the tier. The returned function releases the slot.
+func (tier *rateTier) acquireConcurrency() (func(), bool) {
+	if tier.config.ConcurrentLimit <= 0 {
+		return func() {}, true
+	}
+
+	if tier.active.Add(1) > int64(tier.config.ConcurrentLimit) {
+		tier.active.Add(-1)
+		return nil, false
+	}
+
+	return func() {
+		tier.active.Add(-1)
+	}, true
+}
+
+// checkTierLimits checks the concurrency limit and quotas of the call's rate tier. Returns a release function for
+// the concurrent request slot, or false if the call has been rejected (the error response has been written).
+func (proxy *BeaconProxy) checkTierLimits(w http.ResponseWriter, limits *sessionLimits) (func(), bool) {
+	tier := limits.tier
+
+	release, ok := tier.acquireConcurrency()
+	if !ok {
+		proxy.writeAPIError(w, &apiErrorResponse{
+			Code:    http.StatusTooManyRequests,
+			Message: "Concurrent request limit exceeded",
+		})
+
+		return nil, false
+	}
+
+	if tier.quotaKey == "" || (tier.config.DailyQuota == 0 && tier.config.MonthlyQuota == 0) {
+		return release, true
+	}
+
+	resetTime, err := proxy.quotas.consume(tier.quotaKey, tier.config.DailyQuota, tier.config.MonthlyQuota)
+	if err != nil {
+		release()
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(resetTime).Seconds())+1))
+		proxy.writeAPIError(w, &apiErrorResponse{
+			Code:    http.StatusTooManyRequests,
+			Message: err.Error(),
+		})
+
+		return nil, false
+	}
+
+	return release, true
+}
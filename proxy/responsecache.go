@@ -0,0 +1,750 @@
+package proxy
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ethpandaops/dugtrio/metrics"
+	"github.com/ethpandaops/dugtrio/pool"
+	"github.com/ethpandaops/dugtrio/types"
+	"github.com/ethpandaops/dugtrio/utils"
+)
+
+type immutablePathKind uint8
+
+const (
+	immutablePathStatic immutablePathKind = iota
+	immutablePathBlock
+	immutablePathState
+)
+
+type immutablePath struct {
+	pattern *regexp.Regexp
+	kind    immutablePathKind
+}
+
+// immutablePaths are api paths that may return immutable data, depending on the block or state identifier.
+var immutablePaths = []immutablePath{
+	{regexp.MustCompile(`^/eth/v1/beacon/genesis$`), immutablePathStatic},
+	{regexp.MustCompile(`^/eth/v1/config/spec$`), immutablePathStatic},
+	{regexp.MustCompile(`^/eth/v[0-9]+/beacon/blocks/([^/]+)(/root|/attestations)?$`), immutablePathBlock},
+	{regexp.MustCompile(`^/eth/v[0-9]+/beacon/blinded_blocks/([^/]+)$`), immutablePathBlock},
+	{regexp.MustCompile(`^/eth/v[0-9]+/beacon/headers/([^/]+)$`), immutablePathBlock},
+	{regexp.MustCompile(`^/eth/v[0-9]+/beacon/blob_sidecars/([^/]+)$`), immutablePathBlock},
+	{regexp.MustCompile(`^/eth/v[0-9]+/beacon/blobs/([^/]+)$`), immutablePathBlock},
+	{regexp.MustCompile(`^/eth/v[0-9]+/debug/beacon/states/([^/]+)$`), immutablePathState},
+	{regexp.MustCompile(`^/eth/v[0-9]+/beacon/states/([^/]+)/.+$`), immutablePathState},
+}
+
+var rootIDPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`)
+
+// ResponseCache is a tiered cache for responses that contain immutable beacon chain data.
+// Small responses are kept in an in-memory LRU, large responses are optionally stored in
+// a content-addressed on-disk store.
+type ResponseCache struct {
+	config       *types.CacheConfig
+	blockCache   *pool.BlockCache
+	proxyMetrics *metrics.ProxyMetrics
+	logger       *logrus.Entry
+
+	memoryMutex sync.Mutex
+	memoryLru   *list.List
+	memoryMap   map[string]*list.Element
+	memorySize  int64
+
+	diskMutex  sync.Mutex
+	diskLru    *list.List
+	diskMap    map[string]*list.Element
+	diskBlobs  map[string]int
+	diskSize   int64
+	diskLoaded bool
+}
+
+type cacheEntry struct {
+	Key    string      `json:"key"`
+	Header http.Header `json:"header"`
+	ETag   string      `json:"etag"`
+	Hash   string      `json:"hash"`
+	Size   int64       `json:"size"`
+	Stored time.Time   `json:"stored"`
+
+	body []byte
+}
+
+func newResponseCache(config *types.CacheConfig, blockCache *pool.BlockCache, proxyMetrics *metrics.ProxyMetrics) *ResponseCache {
+	if config.MemorySize == 0 {
+		config.MemorySize = 256 * 1024 * 1024
+	}
+
+	if config.MemoryMaxEntrySize == 0 {
+		config.MemoryMaxEntrySize = 1024 * 1024
+	}
+
+	if config.DiskSize == 0 {
+		config.DiskSize = 10 * 1024 * 1024 * 1024
+	}
+
+	if config.DiskMaxEntrySize == 0 {
+		config.DiskMaxEntrySize = 512 * 1024 * 1024
+	}
+
+	cache := &ResponseCache{
+		config:       config,
+		blockCache:   blockCache,
+		proxyMetrics: proxyMetrics,
+		logger:       logrus.WithField("module", "cache"),
+		memoryLru:    list.New(),
+		memoryMap:    make(map[string]*list.Element),
+		diskLru:      list.New(),
+		diskMap:      make(map[string]*list.Element),
+		diskBlobs:    make(map[string]int),
+	}
+
+	if config.DiskPath != "" {
+		go cache.loadDiskIndex(time.Now())
+	}
+
+	return cache
+}
+
+// getCaptureLimit returns the maximum response size that can be stored in any cache tier.
+func (cache *ResponseCache) getCaptureLimit() int64 {
+	if cache.config.DiskPath != "" {
+		return max(cache.config.DiskMaxEntrySize, cache.config.MemoryMaxEntrySize)
+	}
+
+	return cache.config.MemoryMaxEntrySize
+}
+
+// getCacheKey returns the cache key for the request, or an empty string if the request does not target immutable data.
+// Client specific endpoints are cached separately, as they are served by a different set of endpoints.
+func (cache *ResponseCache) getCacheKey(r *http.Request, clientType pool.ClientType) string {
+	if r.Method != http.MethodGet {
+		return ""
+	}
+
+	reqPath := path.Clean(r.URL.Path)
+	if !cache.isImmutablePath(reqPath) {
+		return ""
+	}
+
+	query := r.URL.Query()
+	query.Del("dugtrio-next-endpoint")
+
+	keyHash := sha256.New()
+	fmt.Fprintf(keyHash, "%d\n%s\n%s\n%s\n%s", clientType, reqPath, query.Encode(), strings.TrimSpace(r.Header.Get("Accept")), strings.TrimSpace(r.Header.Get("Accept-Encoding")))
+
+	return hex.EncodeToString(keyHash.Sum(nil))
+}
+
+func (cache *ResponseCache) isImmutablePath(reqPath string) bool {
+	for _, immutablePath := range immutablePaths {
+		match := immutablePath.pattern.FindStringSubmatch(reqPath)
+		if match == nil {
+			continue
+		}
+
+		switch immutablePath.kind {
+		case immutablePathStatic:
+			return true
+		case immutablePathBlock, immutablePathState:
+			return cache.isImmutableID(match[1])
+		}
+	}
+
+	return false
+}
+
+// isImmutableID checks if a block or state identifier refers to data that can't change anymore.
+// This is the case for explicit roots, the genesis and slots up to the finalized checkpoint.
+func (cache *ResponseCache) isImmutableID(id string) bool {
+	if id == "genesis" || rootIDPattern.MatchString(id) {
+		return true
+	}
+
+	slot, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	specs := cache.blockCache.GetSpecs()
+	if specs == nil {
+		return false
+	}
+
+	finalizedEpoch, _ := cache.blockCache.GetFinalizedCheckpoint()
+
+	return phase0.Slot(slot) < phase0.Slot(finalizedEpoch)*phase0.Slot(specs.SlotsPerEpoch)
+}
+
+// isCacheableResponse checks the response metadata for hints that the returned data is not final yet.
+// The body is decoded as a token stream, so large responses are never fully unmarshalled.
+func (cache *ResponseCache) isCacheableResponse(header http.Header, body io.Reader) bool {
+	if !strings.HasPrefix(header.Get("Content-Type"), "application/json") {
+		return true
+	}
+
+	if header.Get("Content-Encoding") != "" {
+		// can't inspect the metadata of compressed json responses
+		return false
+	}
+
+	decoder := json.NewDecoder(body)
+
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return false
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+
+		switch token {
+		case "finalized", "execution_optimistic":
+			var value *bool
+			if err := decoder.Decode(&value); err != nil {
+				return false
+			}
+
+			// data must be finalized and not optimistic
+			if value != nil && *value != (token == "finalized") {
+				return false
+			}
+		default:
+			if err := skipJSONValue(decoder); err != nil {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// skipJSONValue consumes the next value of the decoder token by token.
+func skipJSONValue(decoder *json.Decoder) error {
+	depth := 0
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// serveCachedResponse writes the cached response for the key and returns true, or returns false if there is no cached response.
+func (cache *ResponseCache) serveCachedResponse(w http.ResponseWriter, r *http.Request, key string, session *Session) bool {
+	tier := "memory"
+
+	entry := cache.getMemoryEntry(key)
+	if entry == nil {
+		tier = "disk"
+		entry = cache.getDiskEntry(key)
+	}
+
+	if entry == nil {
+		cache.addLookupMetric("miss")
+		return false
+	}
+
+	notModified := false
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && matchETag(ifNoneMatch, entry.ETag) {
+		notModified = true
+	}
+
+	var blobFile *os.File
+
+	if entry.body == nil && !notModified {
+		// open the blob before sending the headers, it might have been evicted since the index lookup
+		file, err := os.Open(cache.getBlobPath(entry.Hash))
+		if err != nil {
+			cache.logger.Debugf("error opening disk cache blob: %v", err)
+			cache.addLookupMetric("miss")
+
+			return false
+		}
+
+		defer file.Close()
+
+		blobFile = file
+	}
+
+	respH := w.Header()
+	for hk, hv := range entry.Header {
+		respH[hk] = hv
+	}
+
+	respH.Set("Etag", entry.ETag)
+	respH.Set("X-Dugtrio-Version", fmt.Sprintf("dugtrio/%v", utils.GetVersion()))
+	respH.Set("X-Dugtrio-Session-Ip", session.group.GetIPAddr())
+	respH.Set("X-Dugtrio-Cache", "hit")
+
+	if notModified {
+		cache.addLookupMetric("not_modified")
+		w.WriteHeader(http.StatusNotModified)
+
+		return true
+	}
+
+	cache.addLookupMetric("hit_" + tier)
+	respH.Set("Content-Length", strconv.FormatInt(entry.Size, 10))
+	w.WriteHeader(http.StatusOK)
+
+	var err error
+
+	if entry.body != nil {
+		_, err = w.Write(entry.body)
+	} else {
+		_, err = io.Copy(w, blobFile)
+	}
+
+	if err != nil {
+		cache.logger.Warnf("error writing cached response: %v", err)
+	}
+
+	return true
+}
+
+func matchETag(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// storeResponse adds a successfully proxied response to the cache.
+func (cache *ResponseCache) storeResponse(key string, rw *cacheResponseWriter) {
+	if rw.overflow {
+		return
+	}
+
+	if rw.file != nil {
+		if _, err := rw.file.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+
+		if !cache.isCacheableResponse(rw.Header(), rw.file) {
+			return
+		}
+	} else if !cache.isCacheableResponse(rw.Header(), bytes.NewReader(rw.memory.Bytes())) {
+		return
+	}
+
+	entry := &cacheEntry{
+		Key:    key,
+		Header: http.Header{},
+		Hash:   hex.EncodeToString(rw.hash.Sum(nil)),
+		Size:   rw.size,
+		Stored: time.Now(),
+	}
+	entry.ETag = fmt.Sprintf("\"%s\"", entry.Hash[:32])
+
+	for _, hk := range passthruResponseHeaderKeys {
+		if hk == "Date" || hk == "Etag" {
+			continue
+		}
+
+		if hv, ok := rw.Header()[hk]; ok {
+			entry.Header[hk] = hv
+		}
+	}
+
+	if rw.file == nil {
+		entry.body = rw.memory.Bytes()
+		cache.addMemoryEntry(entry)
+	} else {
+		err := cache.addDiskEntry(entry, rw.file)
+		if err != nil {
+			cache.logger.Warnf("error storing response in disk cache: %v", err)
+		}
+	}
+}
+
+func (cache *ResponseCache) addLookupMetric(result string) {
+	if cache.proxyMetrics != nil {
+		cache.proxyMetrics.AddCacheLookup(result)
+	}
+}
+
+func (cache *ResponseCache) updateSizeMetric(tier string, entries int, size int64) {
+	if cache.proxyMetrics != nil {
+		cache.proxyMetrics.SetCacheSize(tier, entries, size)
+	}
+}
+
+// memory tier
+
+func (cache *ResponseCache) getMemoryEntry(key string) *cacheEntry {
+	cache.memoryMutex.Lock()
+	defer cache.memoryMutex.Unlock()
+
+	element := cache.memoryMap[key]
+	if element == nil {
+		return nil
+	}
+
+	cache.memoryLru.MoveToFront(element)
+
+	entry, _ := element.Value.(*cacheEntry)
+
+	return entry
+}
+
+func (cache *ResponseCache) addMemoryEntry(entry *cacheEntry) {
+	cache.memoryMutex.Lock()
+	defer cache.memoryMutex.Unlock()
+
+	if element := cache.memoryMap[entry.Key]; element != nil {
+		oldEntry, _ := element.Value.(*cacheEntry)
+		cache.memorySize -= oldEntry.Size
+		cache.memoryLru.Remove(element)
+	}
+
+	cache.memoryMap[entry.Key] = cache.memoryLru.PushFront(entry)
+	cache.memorySize += entry.Size
+
+	for cache.memorySize > cache.config.MemorySize {
+		element := cache.memoryLru.Back()
+		if element == nil {
+			break
+		}
+
+		oldEntry, _ := element.Value.(*cacheEntry)
+		cache.memoryLru.Remove(element)
+		delete(cache.memoryMap, oldEntry.Key)
+		cache.memorySize -= oldEntry.Size
+	}
+
+	cache.updateSizeMetric("memory", len(cache.memoryMap), cache.memorySize)
+}
+
+// disk tier
+
+func (cache *ResponseCache) getBlobPath(hash string) string {
+	return filepath.Join(cache.config.DiskPath, "blobs", hash[:2], hash)
+}
+
+func (cache *ResponseCache) getIndexPath(key string) string {
+	return filepath.Join(cache.config.DiskPath, "index", key+".json")
+}
+
+func (cache *ResponseCache) loadDiskIndex(startTime time.Time) {
+	defer utils.HandleSubroutinePanic("ResponseCache.loadDiskIndex", nil)
+
+	cache.diskMutex.Lock()
+	defer cache.diskMutex.Unlock()
+
+	cache.removeStaleTempFiles(startTime)
+
+	indexFiles, err := os.ReadDir(filepath.Join(cache.config.DiskPath, "index"))
+	if err != nil && !os.IsNotExist(err) {
+		cache.logger.Warnf("error reading disk cache index: %v", err)
+	}
+
+	entries := make([]*cacheEntry, 0, len(indexFiles))
+
+	for _, indexFile := range indexFiles {
+		if indexFile.IsDir() || !strings.HasSuffix(indexFile.Name(), ".json") {
+			continue
+		}
+
+		indexData, err := os.ReadFile(filepath.Join(cache.config.DiskPath, "index", indexFile.Name()))
+		if err != nil {
+			continue
+		}
+
+		entry := &cacheEntry{}
+		if err := json.Unmarshal(indexData, entry); err != nil || entry.Key == "" {
+			continue
+		}
+
+		if _, err := os.Stat(cache.getBlobPath(entry.Hash)); err != nil {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	// oldest entries go to the back of the lru list
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].Stored.Before(entries[b].Stored)
+	})
+
+	for _, entry := range entries {
+		element := cache.diskLru.PushFront(entry)
+		cache.diskMap[entry.Key] = element
+		cache.diskBlobs[entry.Hash]++
+		cache.diskSize += entry.Size
+	}
+
+	cache.diskLoaded = true
+	cache.updateSizeMetric("disk", len(cache.diskMap), cache.diskSize)
+
+	cache.logger.Infof("loaded %v disk cache entries (%v bytes)", len(cache.diskMap), cache.diskSize)
+}
+
+// removeStaleTempFiles removes the temporary files of captures and atomic writes that were interrupted before the start.
+func (cache *ResponseCache) removeStaleTempFiles(startTime time.Time) {
+	err := filepath.WalkDir(cache.config.DiskPath, func(filePath string, dirEntry os.DirEntry, err error) error {
+		if err != nil || dirEntry.IsDir() || !strings.HasPrefix(dirEntry.Name(), ".tmp-") {
+			return nil
+		}
+
+		// temp files of calls that started after the cache are still in use
+		if info, err := dirEntry.Info(); err == nil && info.ModTime().Before(startTime) {
+			os.Remove(filePath)
+		}
+
+		return nil
+	})
+	if err != nil {
+		cache.logger.Warnf("error removing stale disk cache files: %v", err)
+	}
+}
+
+func (cache *ResponseCache) getDiskEntry(key string) *cacheEntry {
+	if cache.config.DiskPath == "" {
+		return nil
+	}
+
+	cache.diskMutex.Lock()
+	defer cache.diskMutex.Unlock()
+
+	element := cache.diskMap[key]
+	if element == nil {
+		return nil
+	}
+
+	cache.diskLru.MoveToFront(element)
+
+	entry, _ := element.Value.(*cacheEntry)
+
+	return entry
+}
+
+// addDiskEntry adds the entry to the disk cache. The body is moved from the temporary capture file to the blob store.
+func (cache *ResponseCache) addDiskEntry(entry *cacheEntry, bodyFile *os.File) error {
+	cache.diskMutex.Lock()
+	defer cache.diskMutex.Unlock()
+
+	if !cache.diskLoaded || cache.diskMap[entry.Key] != nil {
+		return nil
+	}
+
+	if cache.diskBlobs[entry.Hash] == 0 {
+		blobPath := cache.getBlobPath(entry.Hash)
+
+		err := os.MkdirAll(filepath.Dir(blobPath), 0o755)
+		if err != nil {
+			return err
+		}
+
+		err = os.Rename(bodyFile.Name(), blobPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	indexData, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(cache.getIndexPath(entry.Key), indexData)
+	if err != nil {
+		return err
+	}
+
+	cache.diskMap[entry.Key] = cache.diskLru.PushFront(entry)
+	cache.diskBlobs[entry.Hash]++
+	cache.diskSize += entry.Size
+
+	for cache.diskSize > cache.config.DiskSize {
+		element := cache.diskLru.Back()
+		if element == nil {
+			break
+		}
+
+		oldEntry, _ := element.Value.(*cacheEntry)
+		cache.diskLru.Remove(element)
+		delete(cache.diskMap, oldEntry.Key)
+		cache.diskSize -= oldEntry.Size
+
+		os.Remove(cache.getIndexPath(oldEntry.Key))
+
+		cache.diskBlobs[oldEntry.Hash]--
+		if cache.diskBlobs[oldEntry.Hash] <= 0 {
+			delete(cache.diskBlobs, oldEntry.Hash)
+			os.Remove(cache.getBlobPath(oldEntry.Hash))
+		}
+	}
+
+	cache.updateSizeMetric("disk", len(cache.diskMap), cache.diskSize)
+
+	return nil
+}
+
+func writeFileAtomic(filePath string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(filePath), 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(filePath), ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmpFile.Write(data)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), filePath)
+}
+
+// response capture
+
+// cacheResponseWriter captures the response of a cacheable call. Bodies up to the memory entry size are buffered
+// in memory, larger bodies are streamed to a temporary file in the disk cache directory.
+type cacheResponseWriter struct {
+	http.ResponseWriter
+	cache    *ResponseCache
+	status   int
+	memory   *bytes.Buffer
+	file     *os.File
+	hash     hash.Hash
+	size     int64
+	overflow bool
+}
+
+func (cache *ResponseCache) newResponseWriter(w http.ResponseWriter) *cacheResponseWriter {
+	return &cacheResponseWriter{
+		ResponseWriter: w,
+		cache:          cache,
+		memory:         &bytes.Buffer{},
+		hash:           sha256.New(),
+	}
+}
+
+func (rw *cacheResponseWriter) WriteHeader(statusCode int) {
+	if rw.status == 0 {
+		rw.status = statusCode
+	}
+
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *cacheResponseWriter) Write(data []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+
+	if !rw.overflow {
+		rw.capture(data)
+	}
+
+	return rw.ResponseWriter.Write(data)
+}
+
+func (rw *cacheResponseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *cacheResponseWriter) capture(data []byte) {
+	rw.size += int64(len(data))
+	if rw.size > rw.cache.getCaptureLimit() {
+		rw.discard()
+		return
+	}
+
+	rw.hash.Write(data)
+
+	if rw.file == nil && rw.size <= rw.cache.config.MemoryMaxEntrySize {
+		rw.memory.Write(data)
+		return
+	}
+
+	if rw.file == nil {
+		// spill the buffered body to a temporary file in the blob directory, so it can be moved to the blob store
+		tmpDir := filepath.Join(rw.cache.config.DiskPath, "blobs")
+
+		err := os.MkdirAll(tmpDir, 0o755)
+		if err == nil {
+			rw.file, err = os.CreateTemp(tmpDir, ".tmp-*")
+		}
+
+		if err == nil {
+			_, err = rw.file.Write(rw.memory.Bytes())
+		}
+
+		rw.memory = nil
+
+		if err != nil {
+			rw.cache.logger.Warnf("error creating disk cache capture file: %v", err)
+			rw.discard()
+
+			return
+		}
+	}
+
+	if _, err := rw.file.Write(data); err != nil {
+		rw.cache.logger.Warnf("error writing disk cache capture file: %v", err)
+		rw.discard()
+	}
+}
+
+// discard drops the captured body and removes the temporary capture file (if it has not been moved to the blob store).
+func (rw *cacheResponseWriter) discard() {
+	rw.overflow = true
+	rw.memory = nil
+
+	if rw.file != nil {
+		rw.file.Close()
+		os.Remove(rw.file.Name())
+		rw.file = nil
+	}
+}
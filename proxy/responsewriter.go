@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+)
+
+// proxyResponseWriter wraps the downstream response writer to keep track of the
+// response status, size and the time the response headers were written.
+// Optionally it captures the response body up to a size limit.
+type proxyResponseWriter struct {
+	http.ResponseWriter
+	status          int
+	headerTime      time.Time
+	written         int64
+	captureLimit    int64
+	capture         *bytes.Buffer
+	captureOverflow bool
+}
+
+func newProxyResponseWriter(w http.ResponseWriter, captureLimit int64) *proxyResponseWriter {
+	rw := &proxyResponseWriter{
+		ResponseWriter: w,
+		captureLimit:   captureLimit,
+	}
+
+	if captureLimit > 0 {
+		rw.capture = &bytes.Buffer{}
+	}
+
+	return rw
+}
+
+func (rw *proxyResponseWriter) WriteHeader(statusCode int) {
+	if rw.status == 0 {
+		rw.status = statusCode
+		rw.headerTime = time.Now()
+	}
+
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *proxyResponseWriter) Write(data []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+		rw.headerTime = time.Now()
+	}
+
+	if rw.capture != nil && !rw.captureOverflow {
+		if int64(rw.capture.Len()+len(data)) > rw.captureLimit {
+			rw.captureOverflow = true
+			rw.capture = nil
+		} else {
+			rw.capture.Write(data)
+		}
+	}
+
+	written, err := rw.ResponseWriter.Write(data)
+	rw.written += int64(written)
+
+	return written, err
+}
+
+func (rw *proxyResponseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// getCapturedBody returns the captured response body, or false if capturing was disabled or the body exceeded the capture limit.
+func (rw *proxyResponseWriter) getCapturedBody() ([]byte, bool) {
+	if rw.capture == nil {
+		return nil, false
+	}
+
+	return rw.capture.Bytes(), true
+}
@@ -3,10 +3,10 @@ package proxy
 import (
 	"context"
 	"fmt"
-	"net"
+	"math"
 	"net/http"
 	"sort"
-	"strings"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,13 +16,15 @@ import (
 	"golang.org/x/time/rate"
 )
 
-// SessionGroup holds shared state for all sessions from the same IP/ident.
-// The rate limiter and request counter are shared across all prefix-specific
+// SessionGroup holds shared state for all sessions with the same session key (IP/ident by default).
+// The rate limits and request counter are shared across all prefix-specific
 // sessions within the group, so rate limits apply per-client regardless of
 // which prefix endpoints they use.
 type SessionGroup struct {
+	key       string
 	ipAddr    string
-	limiter   *rate.Limiter
+	limits    *sessionLimits
+	acl       *accessControl
 	firstSeen time.Time
 	lastSeen  time.Time
 	requests  atomic.Uint64
@@ -31,6 +33,20 @@ type SessionGroup struct {
 	sessions     map[pool.ClientType]*Session
 }
 
+// sessionLimits holds the rate limit state of a rate limit key. It is resolved on every call and passed
+// along with the session, so the session groups of different stickiness keys can share one rate limit and vice versa.
+type sessionLimits struct {
+	limiter  *rate.Limiter
+	tier     *rateTier
+	subnet   *SubnetBucket
+	lastSeen time.Time
+
+	// ipLimiter is the limiter of the client IP, it stays in force for anonymous calls with client chosen keys
+	ipLimiter *rate.Limiter
+	// clientKeys are the client chosen keys used by the IP (anonymous IP limits only)
+	clientKeys map[string]time.Time
+}
+
 // Session holds per-prefix state for sticky endpoint selection and active
 // connections. Each client-specific prefix (e.g. /lighthouse/, /prysm/) and
 // the main endpoint get their own Session so their sticky endpoint choices
@@ -52,48 +68,61 @@ func (session *Session) init() {
 	session.activeContexts.contexts = make(map[uint64]context.CancelFunc)
 }
 
-func (proxy *BeaconProxy) getSessionForRequest(r *http.Request, ident string, prefix pool.ClientType) *Session {
-	var ip string
-
-	if proxy.config.ProxyCount > 0 {
-		forwardIps := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
-
-		forwardIdx := len(forwardIps) - proxy.config.ProxyCount
-		if forwardIdx >= 0 {
-			ip = strings.Trim(forwardIps[forwardIdx], " ")
-		}
-	}
-
+// getSessionForRequest returns the session for sticky endpoint selection and the rate limits of the call.
+func (proxy *BeaconProxy) getSessionForRequest(w http.ResponseWriter, r *http.Request, identity *AuthIdentity, prefix pool.ClientType) (*Session, *sessionLimits) {
+	ip := proxy.getClientIP(r)
 	if ip == "" {
-		var err error
-
-		ip, _, err = net.SplitHostPort(r.RemoteAddr)
-		if err != nil {
-			return nil
-		}
+		return nil, nil
 	}
 
+	groupKey, limitsKey := proxy.sessionKeys.getSessionKeys(w, r, identity, ip)
+
 	proxy.sessionMutex.Lock()
 	defer proxy.sessionMutex.Unlock()
 
-	if ident != "" {
-		ip = fmt.Sprintf("%s-%s", ip, ident)
+	var limits *sessionLimits
+
+	if identity == nil {
+		// header & cookie keys are chosen by the client, so the limits of the client IP stay in force
+		ipLimits := proxy.getSessionLimits(ip, nil, ip)
+		groupKey = proxy.checkClientKey(ipLimits, groupKey, ip)
+		limitsKey = proxy.checkClientKey(ipLimits, limitsKey, ip)
+
+		limits = ipLimits
+		if limitsKey != ip {
+			keyLimits := proxy.getSessionLimits(limitsKey, nil, ip)
+			limits = &sessionLimits{
+				limiter:   keyLimits.limiter,
+				tier:      ipLimits.tier,
+				subnet:    ipLimits.subnet,
+				ipLimiter: ipLimits.limiter,
+			}
+		}
+	} else {
+		limits = proxy.getSessionLimits(limitsKey, identity, ip)
 	}
 
-	group := proxy.sessions[ip]
+	group := proxy.sessions[groupKey]
 	if group == nil {
+		ipAddr := ip
+		if identity != nil {
+			ipAddr = fmt.Sprintf("%s-%s", ip, identity.getKey())
+		}
+
 		group = &SessionGroup{
-			ipAddr:    ip,
+			key:       groupKey,
+			ipAddr:    ipAddr,
+			limits:    limits,
 			firstSeen: time.Now(),
 			lastSeen:  time.Now(),
 			sessions:  make(map[pool.ClientType]*Session, 4),
 		}
 
-		if proxy.config.CallRateLimit > 0 {
-			group.limiter = rate.NewLimiter(rate.Limit(proxy.config.CallRateLimit), proxy.config.CallRateBurst)
+		if identity != nil {
+			group.acl = identity.acl
 		}
 
-		proxy.sessions[ip] = group
+		proxy.sessions[groupKey] = group
 	} else {
 		group.lastSeen = time.Now()
 	}
@@ -118,7 +147,50 @@ func (proxy *BeaconProxy) getSessionForRequest(r *http.Request, ident string, pr
 		session.lastSeen = now
 	}
 
-	return session
+	return session, limits
+}
+
+// getSessionLimits returns the rate limit state of the rate limit key, the caller must hold the session mutex.
+func (proxy *BeaconProxy) getSessionLimits(limitsKey string, identity *AuthIdentity, ip string) *sessionLimits {
+	limits := proxy.sessionLimits[limitsKey]
+	if limits == nil {
+		limits = &sessionLimits{}
+		limits.tier = proxy.getRateTier(identity, limitsKey)
+		limits.limiter = proxy.newGroupLimiter(limits.tier)
+
+		if identity == nil && limitsKey == ip && proxy.subnetLimits != nil {
+			// authenticated clients are limited by their identity
+			limits.subnet = proxy.subnetLimits.addClient(ip)
+		}
+
+		proxy.sessionLimits[limitsKey] = limits
+	} else if limits.subnet != nil {
+		proxy.subnetLimits.touch(limits.subnet)
+	}
+
+	limits.lastSeen = time.Now()
+
+	return limits
+}
+
+// checkClientKey returns the key, or the IP if the IP has already used too many other client chosen keys.
+// The caller must hold the session mutex.
+func (proxy *BeaconProxy) checkClientKey(ipLimits *sessionLimits, key, ip string) string {
+	if key == ip {
+		return key
+	}
+
+	if ipLimits.clientKeys == nil {
+		ipLimits.clientKeys = map[string]time.Time{}
+	}
+
+	if _, known := ipLimits.clientKeys[key]; !known && len(ipLimits.clientKeys) >= proxy.sessionKeys.maxKeysPerIP {
+		return ip
+	}
+
+	ipLimits.clientKeys[key] = time.Now()
+
+	return key
 }
 
 // GetSessionGroups returns all session groups sorted by firstSeen.
@@ -169,10 +241,10 @@ func (proxy *BeaconProxy) cleanupSessions() {
 
 		proxy.sessionMutex.Lock()
 
-		for ip, group := range proxy.sessions {
+		for key, group := range proxy.sessions {
 			if time.Since(group.lastSeen) > proxy.config.SessionTimeout {
 				// Entire group expired, remove it.
-				delete(proxy.sessions, ip)
+				delete(proxy.sessions, key)
 
 				continue
 			}
@@ -189,30 +261,154 @@ func (proxy *BeaconProxy) cleanupSessions() {
 			group.sessionMutex.Unlock()
 		}
 
+		for key, limits := range proxy.sessionLimits {
+			if time.Since(limits.lastSeen) > proxy.config.SessionTimeout {
+				delete(proxy.sessionLimits, key)
+
+				if limits.subnet != nil {
+					proxy.subnetLimits.removeClient(limits.subnet)
+				}
+
+				continue
+			}
+
+			for clientKey, lastSeen := range limits.clientKeys {
+				if time.Since(lastSeen) > proxy.config.SessionTimeout {
+					delete(limits.clientKeys, clientKey)
+				}
+			}
+		}
+
+		if proxy.subnetLimits != nil {
+			proxy.subnetLimits.cleanup(proxy.config.SessionTimeout)
+		}
+
+		// anonymous quota counters expire with the limits of the client IP
+		proxy.quotas.expire("ip:", proxy.config.SessionTimeout)
+
 		proxy.sessionMutex.Unlock()
 	}
 }
 
-// SessionGroup methods
+// sessionLimits methods
 
-func (group *SessionGroup) checkCallLimit(callCost int) error {
-	if group.limiter == nil {
-		return nil
+func (limits *sessionLimits) checkCallLimit(callCost int) error {
+	now := time.Now()
+	reservations := make([]*rate.Reservation, 0, 2)
+
+	cancelReservations := func() {
+		for _, reservation := range reservations {
+			reservation.CancelAt(now)
+		}
+	}
+
+	for _, limiter := range []*rate.Limiter{limits.limiter, limits.ipLimiter} {
+		if limiter == nil {
+			continue
+		}
+
+		// calls that cost more than the burst size would never be allowed
+		reservation := limiter.ReserveN(now, min(callCost, limiter.Burst()))
+		if !reservation.OK() || reservation.DelayFrom(now) > 0 {
+			reservation.CancelAt(now)
+			cancelReservations()
+
+			return fmt.Errorf("call rate limit exceeded")
+		}
+
+		reservations = append(reservations, reservation)
 	}
 
-	if !group.limiter.AllowN(time.Now(), callCost) {
-		return fmt.Errorf("call rate limit exceeded")
+	if limits.subnet != nil && !limits.subnet.allowCall(now, callCost) {
+		// the call is not charged to the address if the subnet limit rejected it
+		cancelReservations()
+
+		return fmt.Errorf("subnet call rate limit exceeded")
 	}
 
 	return nil
 }
 
-func (group *SessionGroup) getCallLimitTokens() float64 {
-	if group.limiter == nil {
+// getLimiters returns all limiters the call is charged to.
+func (limits *sessionLimits) getLimiters() []*rate.Limiter {
+	limiters := make([]*rate.Limiter, 0, 3)
+
+	for _, limiter := range []*rate.Limiter{limits.limiter, limits.ipLimiter} {
+		if limiter != nil {
+			limiters = append(limiters, limiter)
+		}
+	}
+
+	if limits.subnet != nil {
+		limiters = append(limiters, limits.subnet.limiter)
+	}
+
+	return limiters
+}
+
+// addCallCost charges additional cost after a call has been processed. The tokens might go negative, which delays further calls.
+func (limits *sessionLimits) addCallCost(callCost int) {
+	if callCost <= 0 {
+		return
+	}
+
+	for _, limiter := range limits.getLimiters() {
+		limiter.ReserveN(time.Now(), min(callCost, limiter.Burst()))
+	}
+}
+
+// getRateLimiter returns the limiter with the fewest remaining calls (the key, IP or subnet limiter).
+func (limits *sessionLimits) getRateLimiter() *rate.Limiter {
+	var limiter *rate.Limiter
+
+	for _, candidate := range limits.getLimiters() {
+		if candidate.Limit() <= 0 {
+			continue
+		}
+
+		if limiter == nil || candidate.Tokens() < limiter.Tokens() {
+			limiter = candidate
+		}
+	}
+
+	return limiter
+}
+
+// setRateLimitHeaders sets the RateLimit-* headers, and the Retry-After header for limited calls.
+func (limits *sessionLimits) setRateLimitHeaders(header http.Header, callCost int, limited bool) {
+	limiter := limits.getRateLimiter()
+	if limiter == nil || limiter.Limit() <= 0 {
+		return
+	}
+
+	burst := limiter.Burst()
+	limit := float64(limiter.Limit())
+	tokens := limiter.Tokens()
+
+	header.Set("RateLimit-Limit", strconv.Itoa(burst))
+	header.Set("RateLimit-Remaining", strconv.Itoa(max(int(tokens), 0)))
+	header.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil((float64(burst)-tokens)/limit))))
+
+	if limited {
+		retryAfter := math.Ceil((float64(min(callCost, burst)) - tokens) / limit)
+		header.Set("Retry-After", strconv.Itoa(max(int(retryAfter), 1)))
+	}
+}
+
+func (limits *sessionLimits) getCallLimitTokens() float64 {
+	limiter := limits.getRateLimiter()
+	if limiter == nil {
 		return 0
 	}
 
-	return group.limiter.Tokens()
+	return limiter.Tokens()
+}
+
+// SessionGroup methods
+
+// GetKey returns the stickiness key of the group.
+func (group *SessionGroup) GetKey() string {
+	return group.key
 }
 
 func (group *SessionGroup) GetIPAddr() string {
@@ -231,12 +427,18 @@ func (group *SessionGroup) GetRequests() uint64 {
 	return group.requests.Load()
 }
 
+// GetSubnet returns the subnet rate limit bucket the group was created with (nil for authenticated groups or without subnet limits).
+func (group *SessionGroup) GetSubnet() *SubnetBucket {
+	return group.limits.subnet
+}
+
+// GetLimiterTokens returns the tokens of the rate limit the group was created with.
 func (group *SessionGroup) GetLimiterTokens() float64 {
-	if group.limiter == nil {
+	if group.limits.limiter == nil {
 		return 0
 	}
 
-	return group.limiter.Tokens()
+	return group.limits.limiter.Tokens()
 }
 
 // GetSessions returns all prefix sessions within this group.
@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethpandaops/dugtrio/types"
+)
+
+const (
+	sessionKeyIP       = "ip"
+	sessionKeyIdentity = "identity"
+	sessionKeyHeader   = "header"
+	sessionKeyCookie   = "cookie"
+
+	// maxSessionHeaderLength limits the client controlled header keys, longer values fall back to the IP
+	maxSessionHeaderLength = 128
+)
+
+// sessionKeys derives the stickiness and rate limit keys of a call from the configured strategies.
+type sessionKeys struct {
+	proxy        *BeaconProxy
+	stickiness   string
+	rateLimit    string
+	header       string
+	cookieName   string
+	cookieMaxAge time.Duration
+	cookieSecret []byte
+	maxKeysPerIP int
+}
+
+func (proxy *BeaconProxy) newSessionKeys(config *types.SessionKeysConfig) (*sessionKeys, error) {
+	if config == nil {
+		config = &types.SessionKeysConfig{}
+	}
+
+	keys := &sessionKeys{
+		proxy:        proxy,
+		stickiness:   strings.ToLower(config.Stickiness),
+		rateLimit:    strings.ToLower(config.RateLimit),
+		header:       config.Header,
+		cookieName:   config.CookieName,
+		cookieMaxAge: config.CookieMaxAge,
+		cookieSecret: []byte(config.CookieSecret),
+		maxKeysPerIP: config.MaxKeysPerIP,
+	}
+
+	if keys.stickiness == "" {
+		keys.stickiness = sessionKeyIP
+	}
+
+	if keys.rateLimit == "" {
+		keys.rateLimit = sessionKeyIP
+	}
+
+	for _, strategy := range []string{keys.stickiness, keys.rateLimit} {
+		switch strategy {
+		case sessionKeyIP, sessionKeyIdentity, sessionKeyHeader, sessionKeyCookie:
+		default:
+			return nil, fmt.Errorf("invalid session key strategy '%v'", strategy)
+		}
+	}
+
+	if keys.header == "" {
+		keys.header = "X-Dugtrio-Session"
+	}
+
+	if keys.cookieName == "" {
+		keys.cookieName = "dugtrio_session"
+	}
+
+	if keys.maxKeysPerIP <= 0 {
+		keys.maxKeysPerIP = 16
+	}
+
+	if keys.cookieMaxAge == 0 {
+		keys.cookieMaxAge = 24 * time.Hour
+	}
+
+	if len(keys.cookieSecret) == 0 && keys.usesStrategy(sessionKeyCookie) {
+		keys.cookieSecret = make([]byte, 32)
+		if _, err := rand.Read(keys.cookieSecret); err != nil {
+			return nil, fmt.Errorf("error generating session cookie secret: %w", err)
+		}
+
+		proxy.logger.Infof("no session cookie secret configured, session cookies are invalidated on restart")
+	}
+
+	return keys, nil
+}
+
+func (keys *sessionKeys) usesStrategy(strategy string) bool {
+	return keys.stickiness == strategy || keys.rateLimit == strategy
+}
+
+// getSessionKeys returns the stickiness and rate limit key of the call. A new session cookie is issued if the
+// cookie strategy is used and the client did not send a valid one.
+func (keys *sessionKeys) getSessionKeys(w http.ResponseWriter, r *http.Request, identity *AuthIdentity, ip string) (string, string) {
+	cookieID := ""
+	if keys.usesStrategy(sessionKeyCookie) {
+		cookieID = keys.getSessionCookie(w, r)
+	}
+
+	return keys.getKey(keys.stickiness, r, identity, ip, cookieID), keys.getKey(keys.rateLimit, r, identity, ip, cookieID)
+}
+
+func (keys *sessionKeys) getKey(strategy string, r *http.Request, identity *AuthIdentity, ip, cookieID string) string {
+	key := ""
+
+	switch strategy {
+	case sessionKeyIdentity:
+		if identity != nil {
+			return fmt.Sprintf("auth:%s", identity.getKey())
+		}
+	case sessionKeyHeader:
+		if value := r.Header.Get(keys.header); value != "" && len(value) <= maxSessionHeaderLength {
+			key = fmt.Sprintf("header:%s", value)
+		}
+	case sessionKeyCookie:
+		if cookieID != "" {
+			key = fmt.Sprintf("cookie:%s", cookieID)
+		}
+	}
+
+	if key == "" {
+		key = ip
+	}
+
+	// sessions are never shared between identities (including same-named identities of different auth types),
+	// so the access control of the group stays consistent
+	if identity != nil {
+		key = fmt.Sprintf("%s-%s", key, identity.getKey())
+	}
+
+	return key
+}
+
+// getSessionCookie returns the session ID of a valid session cookie, or issues a new session cookie.
+func (keys *sessionKeys) getSessionCookie(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(keys.cookieName); err == nil {
+		if sessionID, ok := keys.verifySessionCookie(cookie.Value); ok {
+			return sessionID
+		}
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return ""
+	}
+
+	sessionID := hex.EncodeToString(idBytes)
+
+	secure := r.TLS != nil
+	if !secure && keys.proxy.isTrustedRemote(r) {
+		secure = r.Header.Get("X-Forwarded-Proto") == "https"
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     keys.cookieName,
+		Value:    fmt.Sprintf("%s.%s", sessionID, keys.signSessionID(sessionID)),
+		Path:     "/",
+		MaxAge:   int(keys.cookieMaxAge.Seconds()),
+		Secure:   secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return sessionID
+}
+
+func (keys *sessionKeys) signSessionID(sessionID string) string {
+	mac := hmac.New(sha256.New, keys.cookieSecret)
+	mac.Write([]byte(sessionID))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (keys *sessionKeys) verifySessionCookie(value string) (string, bool) {
+	sessionID, signature, found := strings.Cut(value, ".")
+	if !found || sessionID == "" {
+		return "", false
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(keys.signSessionID(sessionID))) {
+		return "", false
+	}
+
+	return sessionID, true
+}
@@ -0,0 +1,481 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ethpandaops/dugtrio/metrics"
+	"github.com/ethpandaops/dugtrio/pool"
+	"github.com/ethpandaops/dugtrio/types"
+	"github.com/ethpandaops/dugtrio/utils"
+)
+
+// defaultShadowPaths are the path patterns that are checked for consistency by default.
+var defaultShadowPaths = []string{
+	"^/eth/v[0-9]+/beacon/",
+	"^/eth/v[0-9]+/config/",
+}
+
+// defaultShadowIgnoredFields are response fields that legitimately differ between endpoints.
+var defaultShadowIgnoredFields = []string{
+	"seq_number",
+}
+
+// ShadowChecker mirrors a sample of proxied GET calls to other endpoints and compares the responses.
+type ShadowChecker struct {
+	proxy         *BeaconProxy
+	config        *types.ShadowConfig
+	proxyMetrics  *metrics.ProxyMetrics
+	logger        *logrus.Entry
+	paths         []*regexp.Regexp
+	ignoredFields map[string]bool
+
+	mutex       sync.Mutex
+	stats       map[string]*ShadowStats
+	divergences []*ShadowDivergence
+}
+
+// ShadowStats are the consistency check results of one endpoint pair and path pattern.
+type ShadowStats struct {
+	Primary     string
+	Shadow      string
+	Path        string
+	Checks      uint64
+	Divergences uint64
+	Errors      uint64
+	LastCheck   time.Time
+}
+
+// ShadowDivergence is a recorded response mismatch between two endpoints.
+type ShadowDivergence struct {
+	Time          time.Time
+	Method        string
+	URL           string
+	Primary       string
+	Shadow        string
+	PrimaryStatus int
+	ShadowStatus  int
+	PrimaryBody   []byte
+	ShadowBody    []byte
+	Difference    string
+}
+
+type shadowCall struct {
+	request *http.Request
+	pattern string
+	primary *pool.Client
+	status  int
+	body    []byte
+}
+
+func newShadowChecker(proxy *BeaconProxy, config *types.ShadowConfig, proxyMetrics *metrics.ProxyMetrics) *ShadowChecker {
+	if config.SampleRate == 0 {
+		config.SampleRate = 0.01
+	}
+
+	if config.Endpoints == 0 {
+		config.Endpoints = 1
+	}
+
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = 1024 * 1024
+	}
+
+	if config.MaxDivergences == 0 {
+		config.MaxDivergences = 100
+	}
+
+	if config.Paths == nil && config.PathsStr == "" {
+		config.Paths = defaultShadowPaths
+	}
+
+	if config.IgnoredFields == nil {
+		config.IgnoredFields = defaultShadowIgnoredFields
+	}
+
+	checker := &ShadowChecker{
+		proxy:         proxy,
+		config:        config,
+		proxyMetrics:  proxyMetrics,
+		logger:        logrus.WithField("module", "shadow"),
+		paths:         proxy.compilePathPatterns(config.Paths, config.PathsStr),
+		ignoredFields: map[string]bool{},
+		stats:         map[string]*ShadowStats{},
+	}
+
+	for _, field := range config.IgnoredFields {
+		checker.ignoredFields[field] = true
+	}
+
+	return checker
+}
+
+// getSamplePattern decides whether the call is mirrored and returns the matching path pattern.
+func (checker *ShadowChecker) getSamplePattern(r *http.Request) string {
+	if r.Method != http.MethodGet || isEventStreamRequest(r) || hasNextEndpointOverride(r) {
+		return ""
+	}
+
+	for _, pathPattern := range checker.paths {
+		if pathPattern.MatchString(r.URL.EscapedPath()) {
+			if rand.Float64() >= checker.config.SampleRate {
+				return ""
+			}
+
+			return pathPattern.String()
+		}
+	}
+
+	return ""
+}
+
+func (checker *ShadowChecker) getCaptureLimit() int64 {
+	return checker.config.MaxBodySize
+}
+
+// startCheck mirrors the call to other endpoints in the background, after the primary response has been sent.
+func (checker *ShadowChecker) startCheck(r *http.Request, pattern string, primary *pool.Client, status int, header http.Header, body []byte) {
+	body, ok := decodeShadowBody(header, body)
+	if !ok {
+		return
+	}
+
+	// the shadow calls run after the client request finished, so they need their own request copy
+	request := r.Clone(context.Background())
+	request.Header.Del("Accept-Encoding")
+
+	call := &shadowCall{
+		request: request,
+		pattern: pattern,
+		primary: primary,
+		status:  status,
+		body:    bytes.Clone(body),
+	}
+
+	go checker.runCheck(call)
+}
+
+// decodeShadowBody returns the uncompressed response body. Returns false for unsupported content encodings.
+func decodeShadowBody(header http.Header, body []byte) ([]byte, bool) {
+	switch header.Get("Content-Encoding") {
+	case "":
+		return body, true
+	case "gzip":
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, false
+		}
+
+		decoded, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, false
+		}
+
+		return decoded, true
+	default:
+		return nil, false
+	}
+}
+
+func (checker *ShadowChecker) runCheck(call *shadowCall) {
+	defer utils.HandleSubroutinePanic("proxy.shadow.check", nil)
+
+	endpoints := make([]*pool.Client, 0, checker.config.Endpoints)
+
+	readyEndpoints := checker.proxy.pool.GetReadyEndpoints(pool.UnspecifiedClient, 0)
+	for _, idx := range rand.Perm(len(readyEndpoints)) {
+		if readyEndpoints[idx] != call.primary && len(endpoints) < checker.config.Endpoints {
+			endpoints = append(endpoints, readyEndpoints[idx])
+		}
+	}
+
+	if len(endpoints) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checker.proxy.config.CallTimeout)
+	defer cancel()
+
+	results := checker.proxy.fanoutCall(ctx, call.request, nil, endpoints)
+
+	for range endpoints {
+		result := <-results
+
+		switch {
+		case result.err != nil:
+			checker.logger.WithField("endpoint", result.endpoint.GetName()).Debugf("shadow call %v failed: %v", call.request.URL.EscapedPath(), result.err)
+			checker.addResult(call, result.endpoint, "error")
+		case int64(len(result.body)) > checker.config.MaxBodySize:
+			// too large for comparison
+		default:
+			checker.compareResult(call, result)
+		}
+	}
+}
+
+func (checker *ShadowChecker) compareResult(call *shadowCall, result *fanoutResult) {
+	difference := ""
+
+	if call.status != result.status {
+		difference = fmt.Sprintf("status %v != %v", call.status, result.status)
+	} else {
+		difference = checker.compareBodies(call.body, result.body)
+	}
+
+	if difference == "" {
+		checker.addResult(call, result.endpoint, "match")
+		return
+	}
+
+	checker.logger.WithFields(logrus.Fields{
+		"primary": call.primary.GetName(),
+		"shadow":  result.endpoint.GetName(),
+	}).Warnf("response divergence on %v: %v", call.request.URL.EscapedPath(), difference)
+
+	checker.addResult(call, result.endpoint, "diverged")
+	checker.addDivergence(&ShadowDivergence{
+		Time:          time.Now(),
+		Method:        call.request.Method,
+		URL:           utils.GetRedactedURL(call.request.URL.String()),
+		Primary:       call.primary.GetName(),
+		Shadow:        result.endpoint.GetName(),
+		PrimaryStatus: call.status,
+		ShadowStatus:  result.status,
+		PrimaryBody:   call.body,
+		ShadowBody:    result.body,
+		Difference:    difference,
+	})
+}
+
+// compareBodies compares two responses and returns a description of the first difference (empty if equal).
+// JSON responses are compared after normalization, other responses byte by byte.
+func (checker *ShadowChecker) compareBodies(primaryBody, shadowBody []byte) string {
+	primaryJSON, primaryErr := parseShadowJSON(primaryBody)
+	shadowJSON, shadowErr := parseShadowJSON(shadowBody)
+
+	if primaryErr != nil || shadowErr != nil {
+		if !bytes.Equal(primaryBody, shadowBody) {
+			return fmt.Sprintf("body mismatch (%v != %v bytes)", len(primaryBody), len(shadowBody))
+		}
+
+		return ""
+	}
+
+	return checker.compareJSON("$", checker.normalizeJSON(primaryJSON), checker.normalizeJSON(shadowJSON))
+}
+
+func parseShadowJSON(body []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value any
+
+	err := decoder.Decode(&value)
+
+	return value, err
+}
+
+// normalizeJSON removes ignored fields and converts all numbers and numeric strings to their canonical decimal representation.
+func (checker *ShadowChecker) normalizeJSON(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if checker.ignoredFields[key] {
+				delete(v, key)
+				continue
+			}
+
+			v[key] = checker.normalizeJSON(field)
+		}
+
+		return v
+	case []any:
+		for idx, item := range v {
+			v[idx] = checker.normalizeJSON(item)
+		}
+
+		return v
+	case json.Number:
+		return normalizeShadowNumber(string(v))
+	case string:
+		return normalizeShadowNumber(v)
+	default:
+		return v
+	}
+}
+
+func normalizeShadowNumber(value string) string {
+	if number, ok := new(big.Int).SetString(value, 10); ok {
+		return number.String()
+	}
+
+	return value
+}
+
+func (checker *ShadowChecker) compareJSON(path string, primary, shadow any) string {
+	switch p := primary.(type) {
+	case map[string]any:
+		s, ok := shadow.(map[string]any)
+		if !ok {
+			return fmt.Sprintf("%v: type mismatch", path)
+		}
+
+		keys := make([]string, 0, len(p)+len(s))
+		for key := range p {
+			keys = append(keys, key)
+		}
+
+		for key := range s {
+			if _, exists := p[key]; !exists {
+				keys = append(keys, key)
+			}
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			primaryField, primaryOk := p[key]
+			shadowField, shadowOk := s[key]
+
+			switch {
+			case !shadowOk:
+				return fmt.Sprintf("%v.%v: missing in shadow response", path, key)
+			case !primaryOk:
+				return fmt.Sprintf("%v.%v: missing in primary response", path, key)
+			}
+
+			if difference := checker.compareJSON(fmt.Sprintf("%v.%v", path, key), primaryField, shadowField); difference != "" {
+				return difference
+			}
+		}
+
+		return ""
+	case []any:
+		s, ok := shadow.([]any)
+		if !ok {
+			return fmt.Sprintf("%v: type mismatch", path)
+		}
+
+		if len(p) != len(s) {
+			return fmt.Sprintf("%v: length %v != %v", path, len(p), len(s))
+		}
+
+		for idx := range p {
+			if difference := checker.compareJSON(fmt.Sprintf("%v[%v]", path, idx), p[idx], s[idx]); difference != "" {
+				return difference
+			}
+		}
+
+		return ""
+	default:
+		if primary != shadow {
+			return fmt.Sprintf("%v: %v != %v", path, formatShadowValue(primary), formatShadowValue(shadow))
+		}
+
+		return ""
+	}
+}
+
+func formatShadowValue(value any) string {
+	str := fmt.Sprintf("%v", value)
+	if len(str) > 80 {
+		str = str[:80] + "..."
+	}
+
+	return str
+}
+
+func (checker *ShadowChecker) addResult(call *shadowCall, shadow *pool.Client, result string) {
+	checker.mutex.Lock()
+
+	statsKey := strings.Join([]string{call.primary.GetName(), shadow.GetName(), call.pattern}, "\n")
+
+	stats := checker.stats[statsKey]
+	if stats == nil {
+		stats = &ShadowStats{
+			Primary: call.primary.GetName(),
+			Shadow:  shadow.GetName(),
+			Path:    call.pattern,
+		}
+		checker.stats[statsKey] = stats
+	}
+
+	stats.Checks++
+	stats.LastCheck = time.Now()
+
+	switch result {
+	case "diverged":
+		stats.Divergences++
+	case "error":
+		stats.Errors++
+	}
+
+	checker.mutex.Unlock()
+
+	if checker.proxyMetrics != nil {
+		checker.proxyMetrics.AddShadowCheck(call.primary.GetName(), shadow.GetName(), call.pattern, result)
+	}
+}
+
+func (checker *ShadowChecker) addDivergence(divergence *ShadowDivergence) {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+
+	checker.divergences = append(checker.divergences, divergence)
+	if len(checker.divergences) > checker.config.MaxDivergences {
+		checker.divergences = checker.divergences[len(checker.divergences)-checker.config.MaxDivergences:]
+	}
+}
+
+// GetStats returns the check results of all endpoint pairs and paths.
+func (checker *ShadowChecker) GetStats() []*ShadowStats {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+
+	stats := make([]*ShadowStats, 0, len(checker.stats))
+	for _, stat := range checker.stats {
+		statCopy := *stat
+		stats = append(stats, &statCopy)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Primary != stats[j].Primary {
+			return stats[i].Primary < stats[j].Primary
+		}
+
+		if stats[i].Shadow != stats[j].Shadow {
+			return stats[i].Shadow < stats[j].Shadow
+		}
+
+		return stats[i].Path < stats[j].Path
+	})
+
+	return stats
+}
+
+// GetDivergences returns the recorded divergences, newest first.
+func (checker *ShadowChecker) GetDivergences() []*ShadowDivergence {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+
+	divergences := make([]*ShadowDivergence, len(checker.divergences))
+	for idx, divergence := range checker.divergences {
+		divergences[len(divergences)-idx-1] = divergence
+	}
+
+	return divergences
+}
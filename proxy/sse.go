@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// sseEvent is a single event read from a server-sent events stream.
+type sseEvent struct {
+	id    string
+	event string
+	data  []byte
+	raw   []byte
+}
+
+// readSSEEvent reads the next event block (all lines up to an empty line) from the stream.
+func readSSEEvent(rd *bufio.Reader) (*sseEvent, error) {
+	evt := &sseEvent{}
+	dataLines := [][]byte{}
+
+	for {
+		line, err := rd.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		evt.raw = append(evt.raw, line...)
+
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			break
+		}
+
+		field, value, _ := bytes.Cut(line, []byte(":"))
+		value = bytes.TrimPrefix(value, []byte(" "))
+
+		switch string(field) {
+		case "id":
+			evt.id = string(value)
+		case "event":
+			evt.event = string(value)
+		case "data":
+			dataLines = append(dataLines, value)
+		}
+	}
+
+	evt.data = bytes.Join(dataLines, []byte("\n"))
+
+	return evt, nil
+}
+
+// knownEventTopics are the event topics of the beacon api spec.
+var knownEventTopics = map[string]bool{
+	"head":                           true,
+	"block":                          true,
+	"block_gossip":                   true,
+	"attestation":                    true,
+	"single_attestation":             true,
+	"voluntary_exit":                 true,
+	"bls_to_execution_change":        true,
+	"proposer_slashing":              true,
+	"attester_slashing":              true,
+	"finalized_checkpoint":           true,
+	"chain_reorg":                    true,
+	"contribution_and_proof":         true,
+	"light_client_finality_update":   true,
+	"light_client_optimistic_update": true,
+	"payload_attributes":             true,
+	"blob_sidecar":                   true,
+	"data_column_sidecar":            true,
+}
+
+// hasOnlyKnownEventTopics checks if all requested event topics are part of the beacon api spec.
+func hasOnlyKnownEventTopics(topics []string) bool {
+	for _, topic := range topics {
+		if !knownEventTopics[topic] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isEventStreamRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.EscapedPath(), "/eth/v1/events")
+}
+
+// getEventStreamTopics returns the sorted and deduplicated list of topics requested for an event stream.
+func getEventStreamTopics(r *http.Request) []string {
+	topicMap := map[string]bool{}
+
+	for _, topicsParam := range r.URL.Query()["topics"] {
+		for _, topic := range strings.Split(topicsParam, ",") {
+			topic = strings.TrimSpace(topic)
+			if topic != "" {
+				topicMap[topic] = true
+			}
+		}
+	}
+
+	topics := make([]string, 0, len(topicMap))
+	for topic := range topicMap {
+		topics = append(topics, topic)
+	}
+
+	sort.Strings(topics)
+
+	return topics
+}
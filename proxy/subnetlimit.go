@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"net/netip"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/ethpandaops/dugtrio/types"
+)
+
+// SubnetBucket is the rate limit bucket shared by all anonymous session groups within the same subnet.
+type SubnetBucket struct {
+	prefix    netip.Prefix
+	limiter   *rate.Limiter
+	firstSeen time.Time
+	lastSeen  atomic.Int64 // unix nano, updated concurrently
+	clients   atomic.Int64
+	requests  atomic.Uint64
+}
+
+// subnetLimits aggregates the anonymous clients by IPv4 / IPv6 prefix, so a client can't evade
+// the rate limit by rotating through the addresses of its subnet.
+type subnetLimits struct {
+	config *types.SubnetLimitsConfig
+
+	mutex   sync.Mutex
+	buckets map[netip.Prefix]*SubnetBucket
+}
+
+func (proxy *BeaconProxy) newSubnetLimits(config *types.SubnetLimitsConfig) *subnetLimits {
+	if config == nil || !config.Enabled {
+		return nil
+	}
+
+	if config.IPv4Prefix <= 0 || config.IPv4Prefix > 32 {
+		config.IPv4Prefix = 24
+	}
+
+	if config.IPv6Prefix <= 0 || config.IPv6Prefix > 128 {
+		config.IPv6Prefix = 64
+	}
+
+	if config.RateLimit == 0 {
+		config.RateLimit = proxy.config.CallRateLimit * 10
+	}
+
+	if config.RateBurst == 0 {
+		config.RateBurst = proxy.config.CallRateBurst * 10
+	}
+
+	if config.RateBurst == 0 {
+		config.RateBurst = int(config.RateLimit) //nolint:gosec // no overflow
+	}
+
+	if config.RateLimit == 0 {
+		proxy.logger.Warnf("subnet limits enabled without rate limit, ignoring")
+		return nil
+	}
+
+	return &subnetLimits{
+		config:  config,
+		buckets: map[netip.Prefix]*SubnetBucket{},
+	}
+}
+
+// getSubnetPrefix returns the subnet the IP is aggregated to.
+func (limits *subnetLimits) getSubnetPrefix(ip string) (netip.Prefix, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+
+	addr = addr.Unmap()
+
+	bits := limits.config.IPv6Prefix
+	if addr.Is4() {
+		bits = limits.config.IPv4Prefix
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+
+	return prefix, true
+}
+
+// addClient returns the bucket of the IP's subnet and counts the new session group in it.
+func (limits *subnetLimits) addClient(ip string) *SubnetBucket {
+	prefix, ok := limits.getSubnetPrefix(ip)
+	if !ok {
+		return nil
+	}
+
+	limits.mutex.Lock()
+	defer limits.mutex.Unlock()
+
+	now := time.Now()
+
+	bucket := limits.buckets[prefix]
+	if bucket == nil {
+		bucket = &SubnetBucket{
+			prefix:    prefix,
+			limiter:   rate.NewLimiter(rate.Limit(limits.config.RateLimit), limits.config.RateBurst),
+			firstSeen: now,
+		}
+
+		limits.buckets[prefix] = bucket
+	}
+
+	bucket.lastSeen.Store(now.UnixNano())
+	bucket.clients.Add(1)
+
+	return bucket
+}
+
+// touch updates the last seen time of the bucket.
+func (limits *subnetLimits) touch(bucket *SubnetBucket) {
+	bucket.lastSeen.Store(time.Now().UnixNano())
+}
+
+// removeClient is called when a session group of the bucket has expired.
+func (limits *subnetLimits) removeClient(bucket *SubnetBucket) {
+	bucket.clients.Add(-1)
+}
+
+// cleanup removes the buckets without session groups that have not been used within the timeout.
+func (limits *subnetLimits) cleanup(timeout time.Duration) {
+	limits.mutex.Lock()
+	defer limits.mutex.Unlock()
+
+	for prefix, bucket := range limits.buckets {
+		if bucket.clients.Load() <= 0 && time.Since(bucket.GetLastSeen()) > timeout {
+			delete(limits.buckets, prefix)
+		}
+	}
+}
+
+// GetSubnetBuckets returns all subnet rate limit buckets sorted by firstSeen (empty if subnet limits are disabled).
+func (proxy *BeaconProxy) GetSubnetBuckets() []*SubnetBucket {
+	if proxy.subnetLimits == nil {
+		return []*SubnetBucket{}
+	}
+
+	proxy.subnetLimits.mutex.Lock()
+	defer proxy.subnetLimits.mutex.Unlock()
+
+	buckets := make([]*SubnetBucket, 0, len(proxy.subnetLimits.buckets))
+	for _, bucket := range proxy.subnetLimits.buckets {
+		buckets = append(buckets, bucket)
+	}
+
+	sort.Slice(buckets, func(a, b int) bool {
+		return buckets[b].firstSeen.After(buckets[a].firstSeen)
+	})
+
+	return buckets
+}
+
+func (bucket *SubnetBucket) allowCall(now time.Time, callCost int) bool {
+	if !bucket.limiter.AllowN(now, min(callCost, bucket.limiter.Burst())) {
+		return false
+	}
+
+	bucket.requests.Add(1)
+
+	return true
+}
+
+func (bucket *SubnetBucket) GetPrefix() string {
+	return bucket.prefix.String()
+}
+
+// GetFirstSeen returns the creation time of the bucket, it's never modified afterwards.
+func (bucket *SubnetBucket) GetFirstSeen() time.Time {
+	return bucket.firstSeen
+}
+
+func (bucket *SubnetBucket) GetLastSeen() time.Time {
+	return time.Unix(0, bucket.lastSeen.Load())
+}
+
+// GetClients returns the number of session groups (addresses) in the subnet.
+func (bucket *SubnetBucket) GetClients() int64 {
+	return bucket.clients.Load()
+}
+
+func (bucket *SubnetBucket) GetRequests() uint64 {
+	return bucket.requests.Load()
+}
+
+func (bucket *SubnetBucket) GetLimiterTokens() float64 {
+	return bucket.limiter.Tokens()
+}
@@ -0,0 +1,327 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ethpandaops/dugtrio/types"
+	"github.com/ethpandaops/dugtrio/utils"
+)
+
+const (
+	usageBucket        = "usage"
+	usageHourFormat    = "2006-01-02T15"
+	usageFlushInterval = 30 * time.Second
+)
+
+// usagePathGroups are the api path groups that are accounted separately, other paths are accounted as "other".
+// Groups with sub classes are split by the next path segment if it is a known sub class.
+var usagePathGroups = map[string]map[string]bool{
+	"beacon": {
+		"blinded_blocks": true,
+		"blob_sidecars":  true,
+		"blobs":          true,
+		"blocks":         true,
+		"headers":        true,
+		"light_client":   true,
+		"pool":           true,
+		"rewards":        true,
+		"states":         true,
+	},
+	"builder":   nil,
+	"config":    nil,
+	"debug":     nil,
+	"events":    nil,
+	"node":      nil,
+	"validator": nil,
+}
+
+// UsageStore accounts requests, response bytes, latency and errors per identity and path class in hourly buckets.
+// The counters are aggregated in memory and flushed to a local bbolt database periodically.
+type UsageStore struct {
+	logger    *logrus.Entry
+	db        *bolt.DB
+	retention time.Duration
+
+	mutex   sync.Mutex
+	pending map[usageKey]*UsageCounters
+}
+
+type usageKey struct {
+	hour      string
+	identity  string
+	pathClass string
+}
+
+// UsageCounters are the accounted values of a usage bucket.
+type UsageCounters struct {
+	Requests   uint64 `json:"requests"`
+	Errors     uint64 `json:"errors"`
+	BytesOut   uint64 `json:"bytes_out"`
+	LatencySum uint64 `json:"latency_sum_ms"`
+	LatencyMax uint64 `json:"latency_max_ms"`
+}
+
+// UsageRecord is the usage of an identity and path class within an hour.
+type UsageRecord struct {
+	Hour      time.Time `json:"hour"`
+	Identity  string    `json:"identity"`
+	PathClass string    `json:"path_class"`
+	UsageCounters
+}
+
+func newUsageStore(config *types.UsageConfig) (*UsageStore, error) {
+	db, err := bolt.Open(config.DBPath, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening usage database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(usageBucket))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error initializing usage database: %w", err)
+	}
+
+	store := &UsageStore{
+		logger:    logrus.WithField("module", "usage"),
+		db:        db,
+		retention: config.Retention,
+		pending:   map[usageKey]*UsageCounters{},
+	}
+
+	go store.runFlushLoop()
+
+	return store, nil
+}
+
+// getUsageIdentity returns the identity calls are accounted to: the auth identity, or the IP for anonymous calls.
+func getUsageIdentity(identity *AuthIdentity, ipAddr string) string {
+	if identity != nil {
+		return identity.getKey()
+	}
+
+	return fmt.Sprintf("ip:%v", ipAddr)
+}
+
+// getUsagePathClass returns the path class of an api path, e.g. "beacon/states", "validator" or "other".
+func getUsagePathClass(path string) string {
+	pathParts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(pathParts) < 3 || pathParts[0] != "eth" || !strings.HasPrefix(pathParts[1], "v") {
+		return "other"
+	}
+
+	subClasses, isGroup := usagePathGroups[pathParts[2]]
+	if !isGroup {
+		return "other"
+	}
+
+	if len(pathParts) > 3 && subClasses[pathParts[3]] {
+		return pathParts[2] + "/" + pathParts[3]
+	}
+
+	return pathParts[2]
+}
+
+func (store *UsageStore) record(identity, pathClass string, status int, bytesOut int64, latency time.Duration) {
+	key := usageKey{
+		hour:      time.Now().UTC().Format(usageHourFormat),
+		identity:  identity,
+		pathClass: pathClass,
+	}
+
+	latencyMs := uint64(max(latency.Milliseconds(), 0))
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	counters := store.pending[key]
+	if counters == nil {
+		counters = &UsageCounters{}
+		store.pending[key] = counters
+	}
+
+	counters.Requests++
+	counters.BytesOut += uint64(max(bytesOut, 0))
+	counters.LatencySum += latencyMs
+	counters.LatencyMax = max(counters.LatencyMax, latencyMs)
+
+	if status >= 400 {
+		counters.Errors++
+	}
+}
+
+// Add adds the values of other to the counters.
+func (counters *UsageCounters) Add(other *UsageCounters) {
+	counters.Requests += other.Requests
+	counters.Errors += other.Errors
+	counters.BytesOut += other.BytesOut
+	counters.LatencySum += other.LatencySum
+	counters.LatencyMax = max(counters.LatencyMax, other.LatencyMax)
+}
+
+// GetLatencyAvg returns the average latency in milliseconds.
+func (counters *UsageCounters) GetLatencyAvg() float64 {
+	if counters.Requests == 0 {
+		return 0
+	}
+
+	return float64(counters.LatencySum) / float64(counters.Requests)
+}
+
+func (store *UsageStore) runFlushLoop() {
+	defer utils.HandleSubroutinePanic("proxy.usage.flush", store.runFlushLoop)
+
+	for {
+		time.Sleep(usageFlushInterval)
+
+		err := store.flush()
+		if err != nil {
+			store.logger.Warnf("error flushing usage counters: %v", err)
+		}
+
+		err = store.prune()
+		if err != nil {
+			store.logger.Warnf("error pruning usage counters: %v", err)
+		}
+	}
+}
+
+// flush merges the pending counters into the database.
+func (store *UsageStore) flush() error {
+	store.mutex.Lock()
+	pending := store.pending
+	store.pending = map[usageKey]*UsageCounters{}
+	store.mutex.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(usageBucket))
+
+		for key, counters := range pending {
+			dbKey := []byte(fmt.Sprintf("%v|%v|%v", key.hour, key.identity, key.pathClass))
+
+			if data := bucket.Get(dbKey); data != nil {
+				stored := &UsageCounters{}
+				if err := json.Unmarshal(data, stored); err != nil {
+					store.logger.Warnf("error decoding usage counters %v: %v", string(dbKey), err)
+				} else {
+					counters.Add(stored)
+				}
+			}
+
+			data, err := json.Marshal(counters)
+			if err != nil {
+				return err
+			}
+
+			if err := bucket.Put(dbKey, data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// prune deletes the buckets older than the retention period.
+func (store *UsageStore) prune() error {
+	if store.retention <= 0 {
+		return nil
+	}
+
+	cutoff := []byte(time.Now().UTC().Add(-store.retention).Format(usageHourFormat))
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(usageBucket))
+		expired := [][]byte{}
+
+		cursor := bucket.Cursor()
+		for key, _ := cursor.First(); key != nil && bytes.Compare(key, cutoff) < 0; key, _ = cursor.Next() {
+			expired = append(expired, bytes.Clone(key))
+		}
+
+		for _, key := range expired {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetUsage returns the usage records of the hours within the time range, optionally filtered by identity (empty = all identities).
+func (store *UsageStore) GetUsage(from, to time.Time, identity string) ([]*UsageRecord, error) {
+	err := store.flush()
+	if err != nil {
+		store.logger.Warnf("error flushing usage counters: %v", err)
+	}
+
+	fromKey := []byte(from.UTC().Format(usageHourFormat))
+	toKey := []byte(to.UTC().Truncate(time.Hour).Add(time.Hour).Format(usageHourFormat))
+	records := []*UsageRecord{}
+
+	err = store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket([]byte(usageBucket)).Cursor()
+
+		for key, data := cursor.Seek(fromKey); key != nil && bytes.Compare(key, toKey) < 0; key, data = cursor.Next() {
+			record, err := parseUsageRecord(key, data)
+			if err != nil {
+				store.logger.Warnf("error decoding usage counters %v: %v", string(key), err)
+				continue
+			}
+
+			if identity != "" && record.Identity != identity {
+				continue
+			}
+
+			records = append(records, record)
+		}
+
+		return nil
+	})
+
+	return records, err
+}
+
+func parseUsageRecord(key, data []byte) (*UsageRecord, error) {
+	// identities might contain the separator, the hour and path class do not
+	keyStr := string(key)
+	hourEnd := strings.Index(keyStr, "|")
+	classStart := strings.LastIndex(keyStr, "|")
+
+	if hourEnd < 0 || classStart <= hourEnd {
+		return nil, fmt.Errorf("invalid key")
+	}
+
+	hour, err := time.Parse(usageHourFormat, keyStr[:hourEnd])
+	if err != nil {
+		return nil, err
+	}
+
+	record := &UsageRecord{
+		Hour:      hour,
+		Identity:  keyStr[hourEnd+1 : classStart],
+		PathClass: keyStr[classStart+1:],
+	}
+
+	err = json.Unmarshal(data, &record.UsageCounters)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
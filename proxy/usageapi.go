@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var usageTimeFormats = []string{
+	time.RFC3339,
+	usageHourFormat,
+	"2006-01-02",
+}
+
+// GetUsageStore returns the usage accounting store (nil if disabled).
+func (proxy *BeaconProxy) GetUsageStore() *UsageStore {
+	return proxy.usage
+}
+
+// ServeUsageHTTP serves the usage records of the requested time range as JSON.
+func (proxy *BeaconProxy) ServeUsageHTTP(w http.ResponseWriter, r *http.Request) {
+	records, ok := proxy.getUsageRecordsForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(map[string]any{
+		"data": records,
+	})
+	if err != nil {
+		proxy.logger.Warnf("error writing usage response: %v", err)
+	}
+}
+
+// ServeUsageCSVHTTP serves the usage records of the requested time range as CSV export.
+func (proxy *BeaconProxy) ServeUsageCSVHTTP(w http.ResponseWriter, r *http.Request) {
+	records, ok := proxy.getUsageRecordsForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"usage-%v.csv\"", time.Now().UTC().Format("20060102-150405")))
+
+	csvWriter := csv.NewWriter(w)
+	rows := [][]string{
+		{"hour", "identity", "path_class", "requests", "errors", "bytes_out", "latency_avg_ms", "latency_max_ms"},
+	}
+
+	for _, record := range records {
+		rows = append(rows, []string{
+			record.Hour.Format(time.RFC3339),
+			record.Identity,
+			record.PathClass,
+			strconv.FormatUint(record.Requests, 10),
+			strconv.FormatUint(record.Errors, 10),
+			strconv.FormatUint(record.BytesOut, 10),
+			strconv.FormatFloat(record.GetLatencyAvg(), 'f', 2, 64),
+			strconv.FormatUint(record.LatencyMax, 10),
+		})
+	}
+
+	err := csvWriter.WriteAll(rows)
+	if err != nil {
+		proxy.logger.Warnf("error writing usage csv response: %v", err)
+	}
+}
+
+// getUsageRecordsForRequest returns the usage records for the from, to & identity query parameters.
+// Callers only get their own usage, admin api keys may query any identity (empty = all identities).
+func (proxy *BeaconProxy) getUsageRecordsForRequest(w http.ResponseWriter, r *http.Request) ([]*UsageRecord, bool) {
+	identity, _ := proxy.CheckAuthorization(r)
+	if identity == nil && hasAuthCredentials(r) {
+		proxy.bans.addOffense(proxy.getClientIP(r), BanReasonAuthFailure)
+	}
+
+	if identity == nil {
+		proxy.writeAPIError(w, &apiErrorResponse{
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized",
+		})
+
+		return nil, false
+	}
+
+	if proxy.usage == nil {
+		proxy.writeAPIError(w, &apiErrorResponse{
+			Code:    http.StatusNotFound,
+			Message: "Usage accounting is disabled",
+		})
+
+		return nil, false
+	}
+
+	query := r.URL.Query()
+	now := time.Now()
+
+	from, err := parseUsageTime(query.Get("from"), now.Add(-24*time.Hour))
+	if err != nil {
+		proxy.writeAPIError(w, &apiErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("invalid from parameter: %v", err),
+		})
+
+		return nil, false
+	}
+
+	to, err := parseUsageTime(query.Get("to"), now)
+	if err != nil {
+		proxy.writeAPIError(w, &apiErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("invalid to parameter: %v", err),
+		})
+
+		return nil, false
+	}
+
+	usageIdentity := getUsageIdentity(identity, "")
+	if identity.ApiKey != nil && identity.ApiKey.Admin {
+		usageIdentity = query.Get("identity")
+	}
+
+	records, err := proxy.usage.GetUsage(from, to, usageIdentity)
+	if err != nil {
+		proxy.writeAPIError(w, &apiErrorResponse{
+			Code:    http.StatusInternalServerError,
+			Message: fmt.Sprintf("error loading usage: %v", err),
+		})
+
+		return nil, false
+	}
+
+	return records, true
+}
+
+func parseUsageTime(value string, defaultTime time.Time) (time.Time, error) {
+	if value == "" {
+		return defaultTime, nil
+	}
+
+	for _, format := range usageTimeFormats {
+		if parsed, err := time.Parse(format, value); err == nil {
+			return parsed, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unsupported time format '%v'", value)
+}
@@ -25,20 +25,39 @@ type BeaconClient struct {
 	name      string
 	endpoint  string
 	headers   map[string]string
+	transport *statsTransport
 	clientSvc eth2client.Service
 }
 
 // NewBeaconClient is used to create a new beacon client
 func NewBeaconClient(endpointCfg *types.EndpointConfig) (*BeaconClient, error) {
+	transport, err := newEndpointTransport(endpointCfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating transport: %w", err)
+	}
+
 	client := &BeaconClient{
-		name:     endpointCfg.Name,
-		endpoint: endpointCfg.URL,
-		headers:  endpointCfg.Headers,
+		name:      endpointCfg.Name,
+		endpoint:  endpointCfg.URL,
+		headers:   endpointCfg.Headers,
+		transport: newStatsTransport(transport),
 	}
 
 	return client, nil
 }
 
+// GetHTTPClient returns a http client without timeout that uses the endpoint specific transport.
+func (bc *BeaconClient) GetHTTPClient() *nethttp.Client {
+	return &nethttp.Client{
+		Transport: bc.transport,
+	}
+}
+
+// GetTransportStats returns the connection pool statistics of the endpoint.
+func (bc *BeaconClient) GetTransportStats() TransportStats {
+	return bc.transport.getStats()
+}
+
 func (bc *BeaconClient) Initialize(ctx context.Context) error {
 	if bc.clientSvc != nil {
 		return nil
@@ -48,6 +67,7 @@ func (bc *BeaconClient) Initialize(ctx context.Context) error {
 		http.WithAddress(bc.endpoint),
 		http.WithTimeout(10 * time.Minute),
 		http.WithLogLevel(zerolog.Disabled),
+		http.WithHTTPClient(bc.GetHTTPClient()),
 	}
 
 	// set extra endpoint headers
@@ -77,7 +97,8 @@ func (bc *BeaconClient) getJSON(ctx context.Context, requrl string, returnValue
 		req.Header.Set(headerKey, headerVal)
 	}
 
-	client := &nethttp.Client{Timeout: time.Second * 300}
+	client := bc.GetHTTPClient()
+	client.Timeout = time.Second * 300
 
 	resp, err := client.Do(req)
 	if err != nil {
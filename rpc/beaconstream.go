@@ -157,7 +157,7 @@ func (bs *BeaconStream) subscribeStream(endpoint string, events uint16) *eventst
 				req.Header.Set(headerKey, headerVal)
 			}
 
-			stream, err = eventstream.SubscribeWithRequest("", req)
+			stream, err = eventstream.SubscribeWith("", bs.client.GetHTTPClient(), req)
 		}
 
 		if err != nil {
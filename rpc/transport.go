@@ -0,0 +1,144 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	nethttp "net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/ethpandaops/dugtrio/types"
+)
+
+// newEndpointTransport returns the transport used for all calls to the endpoint (monitoring, event streams & proxied calls).
+func newEndpointTransport(endpointCfg *types.EndpointConfig) (*nethttp.Transport, error) {
+	transportCfg := endpointCfg.Transport
+	if transportCfg == nil {
+		transportCfg = &types.EndpointTransportConfig{}
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   transportCfg.DialTimeout,
+		KeepAlive: transportCfg.KeepAlive,
+	}
+
+	if dialer.Timeout == 0 {
+		dialer.Timeout = 30 * time.Second
+	}
+
+	if dialer.KeepAlive == 0 {
+		dialer.KeepAlive = 30 * time.Second
+	}
+
+	transport := &nethttp.Transport{
+		Proxy:                 nethttp.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxConnsPerHost:       transportCfg.MaxConnsPerHost,
+		MaxIdleConns:          transportCfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   transportCfg.MaxIdleConns,
+		IdleConnTimeout:       transportCfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	// all calls go to the same host, so the idle pool is not split up by host
+	if transport.MaxIdleConns == 0 {
+		transport.MaxIdleConns = 100
+		transport.MaxIdleConnsPerHost = 100
+	}
+
+	if transport.IdleConnTimeout == 0 {
+		transport.IdleConnTimeout = 90 * time.Second
+	}
+
+	protocols := &nethttp.Protocols{}
+
+	switch transportCfg.Protocol {
+	case "", "auto":
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+	case "http1":
+		protocols.SetHTTP1(true)
+	case "http2":
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+	default:
+		return nil, fmt.Errorf("unknown transport protocol '%v'", transportCfg.Protocol)
+	}
+
+	transport.Protocols = protocols
+
+	if endpointCfg.TLS != nil {
+		tlsConfig, err := newEndpointTLSConfig(endpointCfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	if endpointCfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(endpointCfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme '%v'", proxyURL.Scheme)
+		}
+
+		transport.Proxy = nethttp.ProxyURL(proxyURL)
+	}
+
+	if endpointCfg.UnixSocket != "" {
+		if endpointCfg.ProxyURL != "" {
+			return nil, fmt.Errorf("proxy url and unix socket cannot be used together")
+		}
+
+		socketPath := endpointCfg.UnixSocket
+
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}
+	}
+
+	return transport, nil
+}
+
+func newEndpointTLSConfig(config *types.EndpointTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify, //nolint:gosec // explicitly configured per endpoint
+	}
+
+	if config.CAFile != "" {
+		caData, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading tls ca file: %w", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("no certificates found in tls ca file")
+		}
+	}
+
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading tls client certificate: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,125 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	nethttp "net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+)
+
+// TransportStats is a snapshot of the connection pool statistics of an endpoint.
+type TransportStats struct {
+	OpenConns      int64
+	ActiveRequests int64
+	// Dials is the number of established connections, DialErrors the number of failed connection attempts
+	Dials       uint64
+	DialErrors  uint64
+	NewConns    uint64
+	ReusedConns uint64
+}
+
+// statsTransport counts the connections and requests of an endpoint transport.
+type statsTransport struct {
+	transport      *nethttp.Transport
+	openConns      atomic.Int64
+	activeRequests atomic.Int64
+	dials          atomic.Uint64
+	dialErrors     atomic.Uint64
+	newConns       atomic.Uint64
+	reusedConns    atomic.Uint64
+}
+
+type statsConn struct {
+	net.Conn
+	closeOnce sync.Once
+	stats     *statsTransport
+}
+
+type statsBody struct {
+	io.ReadCloser
+	closeOnce sync.Once
+	stats     *statsTransport
+}
+
+func newStatsTransport(transport *nethttp.Transport) *statsTransport {
+	stats := &statsTransport{
+		transport: transport,
+	}
+
+	dialContext := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialContext(ctx, network, addr)
+		if err != nil {
+			stats.dialErrors.Add(1)
+			return nil, err
+		}
+
+		stats.dials.Add(1)
+		stats.openConns.Add(1)
+
+		return &statsConn{
+			Conn:  conn,
+			stats: stats,
+		}, nil
+	}
+
+	return stats
+}
+
+func (stats *statsTransport) RoundTrip(req *nethttp.Request) (*nethttp.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				stats.reusedConns.Add(1)
+			} else {
+				stats.newConns.Add(1)
+			}
+		},
+	}
+
+	stats.activeRequests.Add(1)
+
+	resp, err := stats.transport.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		stats.activeRequests.Add(-1)
+		return nil, err
+	}
+
+	// the request is active until the response body is closed (event streams stay active while connected)
+	resp.Body = &statsBody{
+		ReadCloser: resp.Body,
+		stats:      stats,
+	}
+
+	return resp, nil
+}
+
+func (stats *statsTransport) getStats() TransportStats {
+	return TransportStats{
+		OpenConns:      stats.openConns.Load(),
+		ActiveRequests: stats.activeRequests.Load(),
+		Dials:          stats.dials.Load(),
+		DialErrors:     stats.dialErrors.Load(),
+		NewConns:       stats.newConns.Load(),
+		ReusedConns:    stats.reusedConns.Load(),
+	}
+}
+
+func (conn *statsConn) Close() error {
+	conn.closeOnce.Do(func() {
+		conn.stats.openConns.Add(-1)
+	})
+
+	return conn.Conn.Close()
+}
+
+func (body *statsBody) Close() error {
+	body.closeOnce.Do(func() {
+		body.stats.activeRequests.Add(-1)
+	})
+
+	return body.ReadCloser.Close()
+}
@@ -28,6 +28,41 @@ type EndpointConfig struct {
 	Priority int               `yaml:"priority"`
 	Weight   int               `yaml:"weight"`
 	Headers  map[string]string `yaml:"headers"`
+	// Mirror endpoints are never used to serve calls, but receive a copy of sampled GET calls
+	Mirror bool `yaml:"mirror"`
+	// Labels group endpoints for api key endpoint restrictions
+	Labels []string `yaml:"labels"`
+
+	// TLS settings for https endpoints
+	TLS *EndpointTLSConfig `yaml:"tls"`
+	// ProxyURL routes all calls via a http, https or socks5 proxy
+	ProxyURL string `yaml:"proxyUrl"`
+	// UnixSocket connects to the endpoint via a unix socket instead of the url host (the url is still used for the request path & host header)
+	UnixSocket string `yaml:"unixSocket"`
+	// Transport tunes the connection pool to the endpoint
+	Transport *EndpointTransportConfig `yaml:"transport"`
+}
+
+// EndpointTransportConfig defines the connection pool settings of an endpoint.
+type EndpointTransportConfig struct {
+	// MaxConnsPerHost limits the number of connections (0 = unlimited)
+	MaxConnsPerHost int `yaml:"maxConnsPerHost"`
+	// MaxIdleConns limits the number of idle connections kept for reuse (default: 100)
+	MaxIdleConns    int           `yaml:"maxIdleConns"`
+	IdleConnTimeout time.Duration `yaml:"idleConnTimeout"`
+	KeepAlive       time.Duration `yaml:"keepAlive"`
+	DialTimeout     time.Duration `yaml:"dialTimeout"`
+	// Protocol selects the http version (auto, http1, http2), http2 uses h2c for http:// urls
+	Protocol string `yaml:"protocol"`
+}
+
+// EndpointTLSConfig defines how the endpoint certificate is verified and the client certificate presented to it.
+type EndpointTLSConfig struct {
+	CAFile             string `yaml:"caFile"`
+	CertFile           string `yaml:"certFile"`
+	KeyFile            string `yaml:"keyFile"`
+	ServerName         string `yaml:"serverName"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
 }
 
 type ServerConfig struct {
@@ -37,6 +72,25 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `yaml:"readTimeout" envconfig:"SERVER_READ_TIMEOUT"`
 	WriteTimeout time.Duration `yaml:"writeTimeout" envconfig:"SERVER_WRITE_TIMEOUT"`
 	IdleTimeout  time.Duration `yaml:"idleTimeout" envconfig:"SERVER_IDLE_TIMEOUT"`
+
+	TLS *ServerTLSConfig `yaml:"tls"`
+
+	// ProxyProtocol requires PROXY protocol v1 / v2 headers from the ProxyProtocolSources (at least one source is required)
+	ProxyProtocol           bool     `yaml:"proxyProtocol" envconfig:"SERVER_PROXY_PROTOCOL"`
+	ProxyProtocolSourcesStr string   `envconfig:"SERVER_PROXY_PROTOCOL_SOURCES"`
+	ProxyProtocolSources    []string `yaml:"proxyProtocolSources"`
+}
+
+// ServerTLSConfig enables TLS termination, the certificate files are reloaded when they change.
+type ServerTLSConfig struct {
+	CertFile string `yaml:"certFile" envconfig:"SERVER_TLS_CERT_FILE"`
+	KeyFile  string `yaml:"keyFile" envconfig:"SERVER_TLS_KEY_FILE"`
+	// MinVersion is the minimum TLS version (1.2, 1.3)
+	MinVersion string `yaml:"minVersion" envconfig:"SERVER_TLS_MIN_VERSION"`
+	// ClientCAFile is a CA bundle to verify client certificates against (empty = no client certificates)
+	ClientCAFile string `yaml:"clientCAFile" envconfig:"SERVER_TLS_CLIENT_CA_FILE"`
+	// ClientAuth defines if client certificates are optional or required (optional, require)
+	ClientAuth string `yaml:"clientAuth" envconfig:"SERVER_TLS_CLIENT_AUTH"`
 }
 
 type PoolConfig struct {
@@ -46,15 +100,64 @@ type PoolConfig struct {
 }
 
 type ProxyConfig struct {
-	ProxyCount      int           `yaml:"proxyCount" envconfig:"PROXY_PROXY_COUNT"`
-	CallTimeout     time.Duration `yaml:"callTimeout" envconfig:"PROXY_CALL_TIMEOUT"`
-	SessionTimeout  time.Duration `yaml:"sessionTimeout" envconfig:"PROXY_SESSION_TIMEOUT"`
-	StickyEndpoint  bool          `yaml:"stickyEndpoint" envconfig:"PROXY_STICKY_ENDPOINT"`
-	CallRateLimit   uint64        `yaml:"callRateLimit" envconfig:"PROXY_CALL_RATE_LIMIT"`
-	CallRateBurst   int           `yaml:"callRateBurst" envconfig:"PROXY_CALL_RATE_BURST"`
-	BlockedPathsStr string        `envconfig:"PROXY_BLOCKED_PATHS"`
-	BlockedPaths    []string      `yaml:"blockedPaths"`
-	Auth            *AuthConfig   `yaml:"auth"`
+	ProxyCount      int                 `yaml:"proxyCount" envconfig:"PROXY_PROXY_COUNT"`
+	CallTimeout     time.Duration       `yaml:"callTimeout" envconfig:"PROXY_CALL_TIMEOUT"`
+	SessionTimeout  time.Duration       `yaml:"sessionTimeout" envconfig:"PROXY_SESSION_TIMEOUT"`
+	StickyEndpoint  bool                `yaml:"stickyEndpoint" envconfig:"PROXY_STICKY_ENDPOINT"`
+	CallRateLimit   uint64              `yaml:"callRateLimit" envconfig:"PROXY_CALL_RATE_LIMIT"`
+	CallRateBurst   int                 `yaml:"callRateBurst" envconfig:"PROXY_CALL_RATE_BURST"`
+	CallCosts       []*CallCostConfig   `yaml:"callCosts"`
+	CallCostPerMiB  float64             `yaml:"callCostPerMiB" envconfig:"PROXY_CALL_COST_PER_MIB"` // charged once the response size is known (Content-Length or after the call), so it limits the next calls, not the oversized response itself
+	BlockedPathsStr string              `envconfig:"PROXY_BLOCKED_PATHS"`
+	BlockedPaths    []string            `yaml:"blockedPaths"`
+	AccessRules     *AccessRulesConfig  `yaml:"accessRules"`
+	IPFilter        *IPFilterConfig     `yaml:"ipFilter"`
+	Bans            *BansConfig         `yaml:"bans"`
+	SubnetLimits    *SubnetLimitsConfig `yaml:"subnetLimits"`
+	SessionKeys     *SessionKeysConfig  `yaml:"sessionKeys"`
+	Auth            *AuthConfig         `yaml:"auth"`
+	Cache           *CacheConfig        `yaml:"cache"`
+	EventMux        *EventMuxConfig     `yaml:"eventMux"`
+
+	// TrustedProxies are the IPs / CIDR ranges of reverse proxies whose forwarding headers are trusted (replaces ProxyCount)
+	TrustedProxiesStr string   `envconfig:"PROXY_TRUSTED_PROXIES"`
+	TrustedProxies    []string `yaml:"trustedProxies"`
+	// ForwardedHeader is the header the trusted proxies set the client IP in (X-Forwarded-For, Forwarded or X-Real-IP)
+	ForwardedHeader string `yaml:"forwardedHeader" envconfig:"PROXY_FORWARDED_HEADER"`
+
+	BestValueBlocks      *BestValueBlocksConfig      `yaml:"bestValueBlocks"`
+	AttestationConsensus *AttestationConsensusConfig `yaml:"attestationConsensus"`
+	Shadow               *ShadowConfig               `yaml:"shadow"`
+	Usage                *UsageConfig                `yaml:"usage"`
+
+	// HedgePaths are path patterns for latency critical calls that get hedged to a second endpoint
+	HedgePathsStr string   `envconfig:"PROXY_HEDGE_PATHS"`
+	HedgePaths    []string `yaml:"hedgePaths"`
+	// HedgeDelay is the time to wait for response headers before sending the hedged request
+	HedgeDelay time.Duration `yaml:"hedgeDelay" envconfig:"PROXY_HEDGE_DELAY"`
+	// HedgePercentile uses the observed latency percentile of the path as hedge delay instead (0-1, 0 = disabled)
+	HedgePercentile float64 `yaml:"hedgePercentile" envconfig:"PROXY_HEDGE_PERCENTILE"`
+
+	// CoalescePaths are path patterns for GET calls where concurrent identical requests share one upstream call
+	CoalescePathsStr string   `envconfig:"PROXY_COALESCE_PATHS"`
+	CoalescePaths    []string `yaml:"coalescePaths"`
+
+	// BroadcastPaths are path patterns for publishing POST calls that are sent to all ready endpoints (empty list = disabled)
+	BroadcastPathsStr string   `envconfig:"PROXY_BROADCAST_PATHS"`
+	BroadcastPaths    []string `yaml:"broadcastPaths"`
+
+	// MaxRequestBodySize is the maximum request body size of broadcasted and hedged calls, which are buffered in memory
+	MaxRequestBodySize int64 `yaml:"maxRequestBodySize" envconfig:"PROXY_MAX_REQUEST_BODY_SIZE"`
+
+	// EventReplaySize is the number of recent events kept per event topic for clients reconnecting with Last-Event-ID (0 = disabled)
+	EventReplaySize int `yaml:"eventReplaySize" envconfig:"PROXY_EVENT_REPLAY_SIZE"`
+	// MirrorSampleRate is the share of GET calls that are copied to mirror endpoints (0-1, defaults to 0.1)
+	MirrorSampleRate *float64 `yaml:"mirrorSampleRate" envconfig:"PROXY_MIRROR_SAMPLE_RATE"`
+	// MirrorMaxConcurrent is the maximum number of mirror calls in flight, further samples are dropped
+	MirrorMaxConcurrent int `yaml:"mirrorMaxConcurrent" envconfig:"PROXY_MIRROR_MAX_CONCURRENT"`
+
+	// MergedEvents enables the /dugtrio/events stream with block, head & finalized_checkpoint events from all ready endpoints
+	MergedEvents bool `yaml:"mergedEvents" envconfig:"PROXY_MERGED_EVENTS"`
 
 	// RebalanceInterval is how often to check for session imbalances (0 = disabled)
 	RebalanceInterval time.Duration `yaml:"rebalanceInterval"`
@@ -66,6 +169,39 @@ type ProxyConfig struct {
 	RebalanceMaxSweep int `yaml:"rebalanceMaxSweep"`
 }
 
+// CallCostConfig assigns a rate limit cost to calls matching the path pattern and method (empty method = all methods).
+type CallCostConfig struct {
+	Path   string `yaml:"path"`
+	Method string `yaml:"method"`
+	Cost   int    `yaml:"cost"`
+}
+
+// AccessRulesConfig is an ordered list of access rules, the first matching rule decides about a call.
+type AccessRulesConfig struct {
+	// DefaultAction is the action for calls that match no rule (allow, deny)
+	DefaultAction string              `yaml:"defaultAction" envconfig:"PROXY_ACCESS_RULES_DEFAULT_ACTION"`
+	Rules         []*AccessRuleConfig `yaml:"rules"`
+	// Prefixes are separate rule sets for client specific endpoints (e.g. lighthouse), used instead of the main rule set
+	Prefixes map[string]*AccessRulesConfig `yaml:"prefixes"`
+}
+
+// AccessRuleConfig matches calls by method, path, query parameters, headers and auth identity (empty = any).
+type AccessRuleConfig struct {
+	// Action is the action for matching calls (allow, deny, require-auth)
+	Action  string   `yaml:"action"`
+	Methods []string `yaml:"methods"`
+	Path    string   `yaml:"path"`
+	// Query and Headers map parameter / header names to value patterns (empty pattern = must be present)
+	Query   map[string]string `yaml:"query"`
+	Headers map[string]string `yaml:"headers"`
+	// Identities are the auth identity names the rule applies to
+	Identities []string `yaml:"identities"`
+	// Authenticated limits the rule to authenticated (true) or unauthenticated (false) calls
+	Authenticated *bool `yaml:"authenticated"`
+	// Message is returned to denied calls
+	Message string `yaml:"message"`
+}
+
 type FrontendConfig struct {
 	Enabled  bool   `yaml:"enabled" envconfig:"FRONTEND_ENABLED"`
 	Debug    bool   `yaml:"debug" envconfig:"FRONTEND_DEBUG"`
@@ -74,15 +210,215 @@ type FrontendConfig struct {
 	SiteName string `yaml:"siteName" envconfig:"FRONTEND_SITE_NAME"`
 }
 
+type CacheConfig struct {
+	Enabled bool `yaml:"enabled" envconfig:"PROXY_CACHE_ENABLED"`
+
+	// MemorySize is the maximum size of the in-memory cache in bytes
+	MemorySize int64 `yaml:"memorySize" envconfig:"PROXY_CACHE_MEMORY_SIZE"`
+	// MemoryMaxEntrySize is the maximum response size for the in-memory cache, larger responses go to the disk cache
+	MemoryMaxEntrySize int64 `yaml:"memoryMaxEntrySize" envconfig:"PROXY_CACHE_MEMORY_MAX_ENTRY_SIZE"`
+
+	// DiskPath is the directory for the on-disk cache (empty = disabled)
+	DiskPath string `yaml:"diskPath" envconfig:"PROXY_CACHE_DISK_PATH"`
+	// DiskSize is the maximum size of the on-disk cache in bytes
+	DiskSize int64 `yaml:"diskSize" envconfig:"PROXY_CACHE_DISK_SIZE"`
+	// DiskMaxEntrySize is the maximum response size for the on-disk cache
+	DiskMaxEntrySize int64 `yaml:"diskMaxEntrySize" envconfig:"PROXY_CACHE_DISK_MAX_ENTRY_SIZE"`
+}
+
+type EventMuxConfig struct {
+	Enabled bool `yaml:"enabled" envconfig:"PROXY_EVENT_MUX_ENABLED"`
+
+	// SubscriberBuffer is the number of events buffered per downstream subscriber
+	SubscriberBuffer int `yaml:"subscriberBuffer" envconfig:"PROXY_EVENT_MUX_SUBSCRIBER_BUFFER"`
+	// SlowConsumerPolicy defines how to handle subscribers with a full buffer (disconnect, drop)
+	SlowConsumerPolicy string `yaml:"slowConsumerPolicy" envconfig:"PROXY_EVENT_MUX_SLOW_CONSUMER_POLICY"`
+	// GracePeriod is the time an upstream stream is kept open after the last subscriber left, so the event replay buffer
+	// keeps filling for reconnecting clients (defaults to 5m with event replay enabled)
+	GracePeriod time.Duration `yaml:"gracePeriod" envconfig:"PROXY_EVENT_MUX_GRACE_PERIOD"`
+}
+
+type BestValueBlocksConfig struct {
+	Enabled bool `yaml:"enabled" envconfig:"PROXY_BEST_VALUE_BLOCKS_ENABLED"`
+
+	// Deadline is the time to collect block proposals from the endpoints (without any proposal, the first later one is returned)
+	Deadline time.Duration `yaml:"deadline" envconfig:"PROXY_BEST_VALUE_BLOCKS_DEADLINE"`
+	// MaxEndpoints is the maximum number of endpoints to request a block proposal from (0 = all ready endpoints)
+	MaxEndpoints int `yaml:"maxEndpoints" envconfig:"PROXY_BEST_VALUE_BLOCKS_MAX_ENDPOINTS"`
+}
+
+type AttestationConsensusConfig struct {
+	Enabled bool `yaml:"enabled" envconfig:"PROXY_ATTESTATION_CONSENSUS_ENABLED"`
+
+	// Endpoints is the number of endpoints to request the attestation data from
+	Endpoints int `yaml:"endpoints" envconfig:"PROXY_ATTESTATION_CONSENSUS_ENDPOINTS"`
+	// Deadline is the maximum time to wait for the attestation data from the endpoints
+	Deadline time.Duration `yaml:"deadline" envconfig:"PROXY_ATTESTATION_CONSENSUS_DEADLINE"`
+}
+
+type ShadowConfig struct {
+	Enabled bool `yaml:"enabled" envconfig:"PROXY_SHADOW_ENABLED"`
+
+	// SampleRate is the share of matching GET calls that are mirrored to other endpoints (0-1)
+	SampleRate float64 `yaml:"sampleRate" envconfig:"PROXY_SHADOW_SAMPLE_RATE"`
+	// Endpoints is the number of other endpoints each sampled call is mirrored to
+	Endpoints int `yaml:"endpoints" envconfig:"PROXY_SHADOW_ENDPOINTS"`
+	// Paths are path patterns for calls that are checked for consistency
+	PathsStr string   `envconfig:"PROXY_SHADOW_PATHS"`
+	Paths    []string `yaml:"paths"`
+	// IgnoredFields are JSON fields that are excluded from the comparison
+	IgnoredFields []string `yaml:"ignoredFields"`
+	// MaxBodySize is the maximum response size that is compared
+	MaxBodySize int64 `yaml:"maxBodySize" envconfig:"PROXY_SHADOW_MAX_BODY_SIZE"`
+	// MaxDivergences is the number of recorded divergences kept in memory
+	MaxDivergences int `yaml:"maxDivergences" envconfig:"PROXY_SHADOW_MAX_DIVERGENCES"`
+}
+
+type UsageConfig struct {
+	Enabled bool `yaml:"enabled" envconfig:"PROXY_USAGE_ENABLED"`
+
+	// DBPath is the path of the usage database file
+	DBPath string `yaml:"dbPath" envconfig:"PROXY_USAGE_DB_PATH"`
+	// Retention is how long the hourly usage records are kept (0 = forever)
+	Retention time.Duration `yaml:"retention" envconfig:"PROXY_USAGE_RETENTION"`
+}
+
+// IPFilterConfig restricts the client IPs that may use the proxy, checked before authorization.
+// Entries are IPs or CIDR ranges, denied entries take precedence over allowed ones.
+type IPFilterConfig struct {
+	// Allow limits the proxy to the listed IPs (empty = all IPs allowed)
+	AllowStr string   `envconfig:"PROXY_IP_FILTER_ALLOW"`
+	Allow    []string `yaml:"allow"`
+	DenyStr  string   `envconfig:"PROXY_IP_FILTER_DENY"`
+	Deny     []string `yaml:"deny"`
+}
+
+// BansConfig enables temporary bans of IPs that repeatedly exceed their rate limit or fail authentication.
+// If neither limit is set, IPs are banned after 50 rate limited calls or 10 authentication failures.
+type BansConfig struct {
+	Enabled bool `yaml:"enabled" envconfig:"PROXY_BANS_ENABLED"`
+
+	// Window is the time span offenses are counted in
+	Window time.Duration `yaml:"window" envconfig:"PROXY_BANS_WINDOW"`
+	// MaxRateLimitHits is the number of rate limited calls within the window that trigger a ban (0 = disabled)
+	MaxRateLimitHits int `yaml:"maxRateLimitHits" envconfig:"PROXY_BANS_MAX_RATE_LIMIT_HITS"`
+	// MaxAuthFailures is the number of calls with invalid credentials within the window that trigger a ban (0 = disabled)
+	MaxAuthFailures int `yaml:"maxAuthFailures" envconfig:"PROXY_BANS_MAX_AUTH_FAILURES"`
+	// Duration is how long an IP stays banned
+	Duration time.Duration `yaml:"duration" envconfig:"PROXY_BANS_DURATION"`
+}
+
+// SubnetLimitsConfig enables rate limits that are shared by all anonymous clients of the same IPv4 / IPv6 subnet,
+// in addition to the per-address rate limit. If no limit is set, 10 times the per-address limit is used.
+type SubnetLimitsConfig struct {
+	Enabled bool `yaml:"enabled" envconfig:"PROXY_SUBNET_LIMITS_ENABLED"`
+
+	// IPv4Prefix is the prefix length IPv4 addresses are aggregated by (default 24)
+	IPv4Prefix int `yaml:"ipv4Prefix" envconfig:"PROXY_SUBNET_LIMITS_IPV4_PREFIX"`
+	// IPv6Prefix is the prefix length IPv6 addresses are aggregated by (default 64)
+	IPv6Prefix int `yaml:"ipv6Prefix" envconfig:"PROXY_SUBNET_LIMITS_IPV6_PREFIX"`
+	// RateLimit is the call rate limit per subnet (calls per second)
+	RateLimit uint64 `yaml:"rateLimit" envconfig:"PROXY_SUBNET_LIMITS_RATE_LIMIT"`
+	// RateBurst is the burst size per subnet
+	RateBurst int `yaml:"rateBurst" envconfig:"PROXY_SUBNET_LIMITS_RATE_BURST"`
+}
+
+// SessionKeysConfig selects how clients are told apart for endpoint stickiness and rate limiting.
+// Strategies: "ip" (client IP plus auth identity, default), "identity" (auth identity only, IP for anonymous clients),
+// "header" (value of a request header, IP if missing) or "cookie" (signed session cookie issued by dugtrio).
+type SessionKeysConfig struct {
+	Stickiness string `yaml:"stickiness" envconfig:"PROXY_SESSION_KEYS_STICKINESS"`
+	RateLimit  string `yaml:"rateLimit" envconfig:"PROXY_SESSION_KEYS_RATE_LIMIT"`
+
+	// Header is the request header of the "header" strategy (default X-Dugtrio-Session)
+	Header string `yaml:"header" envconfig:"PROXY_SESSION_KEYS_HEADER"`
+	// CookieName is the cookie of the "cookie" strategy (default dugtrio_session)
+	CookieName string `yaml:"cookieName" envconfig:"PROXY_SESSION_KEYS_COOKIE_NAME"`
+	// CookieSecret signs the session cookies (empty = random secret, cookies are invalidated on restart)
+	CookieSecret string `yaml:"cookieSecret" envconfig:"PROXY_SESSION_KEYS_COOKIE_SECRET"`
+	// CookieMaxAge is the lifetime of the session cookies (default 24h)
+	CookieMaxAge time.Duration `yaml:"cookieMaxAge" envconfig:"PROXY_SESSION_KEYS_COOKIE_MAX_AGE"`
+	// MaxKeysPerIP limits the header / cookie keys of anonymous clients per IP, further keys fall back to the IP (default 16)
+	MaxKeysPerIP int `yaml:"maxKeysPerIP" envconfig:"PROXY_SESSION_KEYS_MAX_KEYS_PER_IP"`
+}
+
 type AuthConfig struct {
 	Required bool     `yaml:"required" envconfig:"PROXY_AUTH_REQUIRED"`
 	Password string   `yaml:"password" envconfig:"PROXY_AUTH_PASSWORD"`
 	ApiKeys  []ApiKey `yaml:"apiKeys"`
+
+	// Unauthenticated are the limits for calls without authentication (applied per IP)
+	Unauthenticated *RateTierConfig `yaml:"unauthenticated"`
+	// QuotaFile is the file the quota counters are persisted to (empty = not persisted)
+	QuotaFile string `yaml:"quotaFile" envconfig:"PROXY_AUTH_QUOTA_FILE"`
+
+	// JWT enables bearer token authentication
+	JWT *JWTConfig `yaml:"jwt"`
+	// ClientCerts are the limits & restrictions of clients authenticated with a TLS client certificate (by subject common name)
+	ClientCerts []AuthProfile `yaml:"clientCerts"`
+}
+
+// JWTConfig configures the validation of "Authorization: Bearer <jwt>" tokens.
+// Tokens are accepted if they are signed with one of the HMAC secrets or a key of the JWKS file.
+type JWTConfig struct {
+	HMACSecretsStr string   `envconfig:"PROXY_AUTH_JWT_HMAC_SECRETS"`
+	HMACSecrets    []string `yaml:"hmacSecrets"`
+	// JWKSFile is a local JWKS file with the public keys, it is reloaded when it changes
+	JWKSFile string `yaml:"jwksFile" envconfig:"PROXY_AUTH_JWT_JWKS_FILE"`
+
+	// Issuer and Audience are the required iss & aud claims (empty = not checked)
+	Issuer   string `yaml:"issuer" envconfig:"PROXY_AUTH_JWT_ISSUER"`
+	Audience string `yaml:"audience" envconfig:"PROXY_AUTH_JWT_AUDIENCE"`
+	// Leeway is the tolerated clock skew for the exp & nbf claims
+	Leeway time.Duration `yaml:"leeway" envconfig:"PROXY_AUTH_JWT_LEEWAY"`
+
+	// IdentityClaim is the claim used as session identity (default: sub)
+	IdentityClaim string `yaml:"identityClaim" envconfig:"PROXY_AUTH_JWT_IDENTITY_CLAIM"`
+	// ProfileClaim is the claim that selects the profile of the token (empty = always use the default profile)
+	ProfileClaim string `yaml:"profileClaim" envconfig:"PROXY_AUTH_JWT_PROFILE_CLAIM"`
+	// DefaultProfile is the profile of tokens without profile claim (empty = no limits / restrictions)
+	DefaultProfile string        `yaml:"defaultProfile" envconfig:"PROXY_AUTH_JWT_DEFAULT_PROFILE"`
+	Profiles       []AuthProfile `yaml:"profiles"`
+}
+
+// AuthProfile defines the rate tier and ACLs of jwt profiles and client certificates, each identity gets its own limits.
+type AuthProfile struct {
+	Name string `yaml:"name"`
+
+	RateTierConfig `yaml:",inline"`
+	ApiKeyACL      `yaml:",inline"`
 }
 
 type ApiKey struct {
 	Name string `yaml:"name"`
 	Key  string `yaml:"key"`
+	// Admin keys may manage the ban list via /dugtrio/bans
+	Admin bool `yaml:"admin"`
+
+	RateTierConfig `yaml:",inline"`
+	ApiKeyACL      `yaml:",inline"`
+}
+
+// ApiKeyACL restricts the paths and endpoints an api key may use (empty = unrestricted).
+type ApiKeyACL struct {
+	// Blocked rejects all calls of the key
+	Blocked bool `yaml:"blocked"`
+	// AllowedPaths are path patterns (regex) the key may call
+	AllowedPaths []string `yaml:"allowedPaths"`
+	// AllowedEndpoints (names), AllowedLabels and AllowedClientTypes restrict the endpoints serving the calls of the key,
+	// an endpoint needs to match each of the configured restrictions
+	AllowedEndpoints   []string `yaml:"allowedEndpoints"`
+	AllowedLabels      []string `yaml:"allowedLabels"`
+	AllowedClientTypes []string `yaml:"allowedClientTypes"`
+}
+
+// RateTierConfig defines the limits of an api key or the unauthenticated tier (0 = global rate limit / unlimited).
+type RateTierConfig struct {
+	RateLimit       uint64 `yaml:"rateLimit"`
+	RateBurst       int    `yaml:"rateBurst"`
+	ConcurrentLimit int    `yaml:"concurrentLimit"`
+	DailyQuota      uint64 `yaml:"dailyQuota"`
+	MonthlyQuota    uint64 `yaml:"monthlyQuota"`
 }
 
 type MetricsConfig struct {
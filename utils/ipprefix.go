@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// ParseIPPrefix parses an IP or CIDR range, single IPs are converted to single address prefixes.
+func ParseIPPrefix(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	addr = addr.Unmap()
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// SplitConfigList combines a yaml list with the comma separated list of the corresponding environment variable.
+func SplitConfigList(entries []string, entriesStr string) []string {
+	allEntries := []string{}
+	allEntries = append(allEntries, entries...)
+
+	for _, entry := range strings.Split(entriesStr, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		allEntries = append(allEntries, entry)
+	}
+
+	return allEntries
+}
@@ -1,18 +1,20 @@
 package utils
 
 import (
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime/debug"
+	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
-// WaitForCtrlC will block/wait until a control-c is pressed
+// WaitForCtrlC will block/wait until a control-c is pressed or a termination signal is received
 func WaitForCtrlC() {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
 }
 
@@ -29,3 +31,23 @@ func HandleSubroutinePanic(identifier string, restartFn func()) {
 		}
 	}
 }
+
+// HandleHTTPPanic is a negroni middleware that answers panicking requests with an internal server error.
+// http.ErrAbortHandler panics are passed on to the http server, so handlers can abort a response on purpose.
+func HandleHTTPPanic(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	defer func() {
+		err := recover()
+		if err == nil {
+			return
+		}
+
+		if err == http.ErrAbortHandler { //nolint:errorlint // sentinel panic value
+			panic(err)
+		}
+
+		logrus.Errorf("uncaught panic in http handler (%v %v): %v, stack: %v", r.Method, r.URL.EscapedPath(), err, string(debug.Stack()))
+		w.WriteHeader(http.StatusInternalServerError)
+	}()
+
+	next(w, r)
+}
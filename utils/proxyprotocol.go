@@ -0,0 +1,311 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const proxyProtocolHeaderTimeout = 10 * time.Second
+
+var (
+	proxyProtocolV1Prefix  = []byte("PROXY ")
+	proxyProtocolV2Sig     = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+	errProxyListenerClosed = errors.New("proxy protocol listener closed")
+	errMissingProxyHeader  = errors.New("missing proxy protocol header")
+)
+
+// ProxyProtocolListener accepts connections with a PROXY protocol v1 / v2 header from the trusted sources.
+// Connections from the trusted sources must start with a header, the remote address of the connection is
+// replaced with the source address of the header. Connections from other sources are accepted as they are.
+type ProxyProtocolListener struct {
+	net.Listener
+	logger  *logrus.Entry
+	sources []netip.Prefix
+
+	connChan  chan net.Conn
+	closeChan chan struct{}
+	closeOnce sync.Once
+	acceptErr error
+}
+
+type proxyProtocolConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	remoteAddr net.Addr
+}
+
+// NewProxyProtocolListener wraps the listener, at least one trusted source is required.
+func NewProxyProtocolListener(listener net.Listener, sources []string) (*ProxyProtocolListener, error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("proxy protocol requires at least one trusted source")
+	}
+
+	proxyListener := &ProxyProtocolListener{
+		Listener:  listener,
+		logger:    logrus.WithField("module", "proxyprotocol"),
+		connChan:  make(chan net.Conn),
+		closeChan: make(chan struct{}),
+	}
+
+	for _, source := range sources {
+		prefix, err := ParseIPPrefix(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy protocol source '%v': %w", source, err)
+		}
+
+		proxyListener.sources = append(proxyListener.sources, prefix)
+	}
+
+	go proxyListener.runAcceptLoop()
+
+	return proxyListener, nil
+}
+
+// runAcceptLoop accepts the connections and reads their headers in separate goroutines, so slow clients don't block the listener.
+func (listener *ProxyProtocolListener) runAcceptLoop() {
+	for {
+		conn, err := listener.Listener.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+
+			listener.closeOnce.Do(func() {
+				listener.acceptErr = err
+				close(listener.closeChan)
+			})
+
+			return
+		}
+
+		go listener.handleConn(conn)
+	}
+}
+
+func (listener *ProxyProtocolListener) handleConn(conn net.Conn) {
+	if !listener.isTrustedSource(conn.RemoteAddr()) {
+		listener.deliverConn(conn)
+		return
+	}
+
+	proxyConn := &proxyProtocolConn{
+		Conn:       conn,
+		reader:     bufio.NewReader(conn),
+		remoteAddr: conn.RemoteAddr(),
+	}
+
+	err := conn.SetReadDeadline(time.Now().Add(proxyProtocolHeaderTimeout))
+	if err == nil {
+		err = proxyConn.readHeader()
+	}
+
+	if err == nil {
+		err = conn.SetReadDeadline(time.Time{})
+	}
+
+	if err != nil {
+		listener.logger.Debugf("error reading proxy protocol header from %v: %v", conn.RemoteAddr(), err)
+		conn.Close()
+
+		return
+	}
+
+	listener.deliverConn(proxyConn)
+}
+
+func (listener *ProxyProtocolListener) deliverConn(conn net.Conn) {
+	select {
+	case listener.connChan <- conn:
+	case <-listener.closeChan:
+		conn.Close()
+	}
+}
+
+func (listener *ProxyProtocolListener) isTrustedSource(addr net.Addr) bool {
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return false
+	}
+
+	ip := addrPort.Addr().Unmap()
+
+	for _, source := range listener.sources {
+		if source.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Accept returns the next connection with a completely read PROXY protocol header.
+func (listener *ProxyProtocolListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-listener.connChan:
+		return conn, nil
+	case <-listener.closeChan:
+		if listener.acceptErr != nil {
+			return nil, listener.acceptErr
+		}
+
+		return nil, errProxyListenerClosed
+	}
+}
+
+func (listener *ProxyProtocolListener) Close() error {
+	listener.closeOnce.Do(func() {
+		close(listener.closeChan)
+	})
+
+	return listener.Listener.Close()
+}
+
+func (conn *proxyProtocolConn) Read(b []byte) (int, error) {
+	return conn.reader.Read(b)
+}
+
+func (conn *proxyProtocolConn) RemoteAddr() net.Addr {
+	return conn.remoteAddr
+}
+
+// readHeader reads the PROXY protocol header, connections from trusted sources without header are rejected.
+func (conn *proxyProtocolConn) readHeader() error {
+	first, err := conn.reader.Peek(1)
+	if err != nil {
+		return err
+	}
+
+	switch first[0] {
+	case proxyProtocolV1Prefix[0]:
+		prefix, err := conn.reader.Peek(len(proxyProtocolV1Prefix))
+		if err != nil || !bytes.Equal(prefix, proxyProtocolV1Prefix) {
+			return errMissingProxyHeader
+		}
+
+		return conn.readHeaderV1()
+	case proxyProtocolV2Sig[0]:
+		sig, err := conn.reader.Peek(len(proxyProtocolV2Sig))
+		if err != nil || !bytes.Equal(sig, proxyProtocolV2Sig) {
+			return errMissingProxyHeader
+		}
+
+		return conn.readHeaderV2()
+	default:
+		return errMissingProxyHeader
+	}
+}
+
+// readHeaderV1 parses a text header ("PROXY TCP4 <src> <dst> <srcport> <dstport>\r\n").
+func (conn *proxyProtocolConn) readHeaderV1() error {
+	// the header is at most 107 bytes long
+	line := make([]byte, 0, 107)
+
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= 107 {
+			return fmt.Errorf("v1 header too long")
+		}
+
+		b, err := conn.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		line = append(line, b)
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) < 2 {
+		return fmt.Errorf("invalid v1 header")
+	}
+
+	if fields[1] == "UNKNOWN" {
+		return nil
+	}
+
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return fmt.Errorf("invalid v1 header")
+	}
+
+	srcIP, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return fmt.Errorf("invalid v1 source address: %w", err)
+	}
+
+	srcPort, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid v1 source port: %w", err)
+	}
+
+	conn.remoteAddr = net.TCPAddrFromAddrPort(netip.AddrPortFrom(srcIP, uint16(srcPort)))
+
+	return nil
+}
+
+// readHeaderV2 parses a binary header, LOCAL commands and unsupported address families keep the connection address.
+func (conn *proxyProtocolConn) readHeaderV2() error {
+	header := make([]byte, 16)
+
+	if _, err := io.ReadFull(conn.reader, header); err != nil {
+		return err
+	}
+
+	if header[12]>>4 != 2 {
+		return fmt.Errorf("unsupported v2 version %v", header[12]>>4)
+	}
+
+	command := header[12] & 0x0F
+	family := header[13]
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(conn.reader, payload); err != nil {
+		return err
+	}
+
+	switch command {
+	case 0x00: // LOCAL (health checks of the proxy)
+		return nil
+	case 0x01: // PROXY
+	default:
+		return fmt.Errorf("unsupported v2 command %v", command)
+	}
+
+	var srcIP netip.Addr
+
+	var srcPort uint16
+
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return fmt.Errorf("invalid v2 ipv4 address block")
+		}
+
+		srcIP = netip.AddrFrom4([4]byte(payload[0:4]))
+		srcPort = binary.BigEndian.Uint16(payload[8:10])
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return fmt.Errorf("invalid v2 ipv6 address block")
+		}
+
+		srcIP = netip.AddrFrom16([16]byte(payload[0:16]))
+		srcPort = binary.BigEndian.Uint16(payload[32:34])
+	default:
+		return nil
+	}
+
+	conn.remoteAddr = net.TCPAddrFromAddrPort(netip.AddrPortFrom(srcIP, srcPort))
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ethpandaops/dugtrio/types"
+)
+
+const tlsReloadInterval = 10 * time.Second
+
+// TLSConfigLoader builds the server TLS config and reloads the certificate & CA files when they change.
+type TLSConfigLoader struct {
+	logger *logrus.Entry
+	config *types.ServerTLSConfig
+
+	minVersion uint16
+	clientAuth tls.ClientAuthType
+
+	mutex     sync.RWMutex
+	tlsConfig *tls.Config
+	fileState map[string]tlsFileState
+}
+
+type tlsFileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewTLSConfigLoader loads the configured certificate files, returns an error if the config is invalid or the files cannot be loaded.
+func NewTLSConfigLoader(config *types.ServerTLSConfig) (*TLSConfigLoader, error) {
+	loader := &TLSConfigLoader{
+		logger: logrus.WithField("module", "tls"),
+		config: config,
+	}
+
+	switch config.MinVersion {
+	case "", "1.2":
+		loader.minVersion = tls.VersionTLS12
+	case "1.3":
+		loader.minVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported tls min version '%v'", config.MinVersion)
+	}
+
+	switch config.ClientAuth {
+	case "", "optional":
+		loader.clientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		loader.clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown tls client auth mode '%v'", config.ClientAuth)
+	}
+
+	if config.ClientCAFile == "" {
+		if config.ClientAuth == "require" {
+			return nil, fmt.Errorf("tls client auth 'require' needs a client CA file")
+		}
+
+		loader.clientAuth = tls.NoClientCert
+	}
+
+	if _, err := loader.reload(); err != nil {
+		return nil, err
+	}
+
+	go loader.runReloadLoop()
+
+	return loader, nil
+}
+
+// GetServerConfig returns the TLS config for the http server, each handshake uses the latest loaded certificates.
+func (loader *TLSConfigLoader) GetServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: loader.minVersion,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			loader.mutex.RLock()
+			defer loader.mutex.RUnlock()
+
+			return loader.tlsConfig, nil
+		},
+	}
+}
+
+func (loader *TLSConfigLoader) runReloadLoop() {
+	defer HandleSubroutinePanic("utils.tls.reload", loader.runReloadLoop)
+
+	for {
+		time.Sleep(tlsReloadInterval)
+
+		reloaded, err := loader.reload()
+		if err != nil {
+			loader.logger.Warnf("error reloading tls certificates: %v", err)
+		} else if reloaded {
+			loader.logger.Infof("reloaded tls certificates")
+		}
+	}
+}
+
+// reload rebuilds the TLS config if any of the files has been changed since it was loaded the last time.
+// The previous config is kept if the files cannot be loaded.
+func (loader *TLSConfigLoader) reload() (bool, error) {
+	files := []string{loader.config.CertFile, loader.config.KeyFile}
+	if loader.config.ClientCAFile != "" {
+		files = append(files, loader.config.ClientCAFile)
+	}
+
+	fileState := make(map[string]tlsFileState, len(files))
+	changed := false
+
+	for _, file := range files {
+		fileInfo, err := os.Stat(file)
+		if err != nil {
+			return false, err
+		}
+
+		state := tlsFileState{
+			modTime: fileInfo.ModTime(),
+			size:    fileInfo.Size(),
+		}
+		fileState[file] = state
+
+		if loader.fileState[file] != state {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(loader.config.CertFile, loader.config.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("error loading certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   loader.minVersion,
+		NextProtos:   []string{"h2", "http/1.1"},
+		ClientAuth:   loader.clientAuth,
+	}
+
+	if loader.config.ClientCAFile != "" {
+		caData, err := os.ReadFile(loader.config.ClientCAFile)
+		if err != nil {
+			return false, fmt.Errorf("error reading client CA file: %w", err)
+		}
+
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(caData) {
+			return false, fmt.Errorf("no certificates found in client CA file")
+		}
+	}
+
+	loader.mutex.Lock()
+	loader.tlsConfig = tlsConfig
+	loader.fileState = fileState
+	loader.mutex.Unlock()
+
+	return true, nil
+}